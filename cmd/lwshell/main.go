@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
@@ -9,55 +11,126 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"lwshell/internal/audit"
 	"lwshell/internal/auth"
 	"lwshell/internal/config"
+	"lwshell/internal/metrics"
 	"lwshell/internal/models"
 	"lwshell/internal/server"
 	"lwshell/internal/ssh"
+	"lwshell/internal/tlscert"
 )
 
 //go:embed web
 var webFS embed.FS
 
-const defaultHTTPAddr = ":21008"
+// defaultHTTPAddr 默认只监听本机回环地址；允许其他主机访问需显式指定 --allow-remote
+const defaultHTTPAddr = "127.0.0.1:21008"
 
 func main() {
+	// 子命令：Web 界面不可用时也能从命令行恢复配置快照；切换存储后端
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		}
+	}
 	connectID := flag.String("connect-id", "", "直接连接指定 ID 的服务器（供 Web 在新终端调用）")
-	httpAddr := flag.String("http", defaultHTTPAddr, "启动 Web 服务地址，例如 :21008")
+	connectUser := flag.String("connect-user", "", "发起连接的 Web 用户，写入访问日志（供 Web 在新终端调用）")
+	httpAddr := flag.String("http", defaultHTTPAddr, "启动 Web 服务地址，例如 127.0.0.1:21008；:21008 表示监听所有网卡（需配合 --allow-remote）")
+	metricsInterval := flag.Duration("metrics-interval", 0, "通过 SSH 采集主机指标的间隔，例如 5m；默认 0 表示不采集（只连接 known_hosts 中的主机）")
+	importSSHConfig := flag.String("import-ssh-config", "", "从 OpenSSH 配置文件导入主机，例如 ~/.ssh/config")
+	importReplace := flag.Bool("import-replace", false, "导入时替换全部服务器（默认与当前配置合并）")
+	dryRun := flag.Bool("dry-run", false, "导入时只显示变更预览，不写入配置")
+	flag.IntVar(&config.MaxBackups, "backup-keep", config.MaxBackups, "每次保存配置前保留的历史快照数量，0 表示不保留")
+	flag.DurationVar(&auth.SessionTTL, "session-ttl", auth.SessionTTL, "登录会话的绝对有效期")
+	flag.DurationVar(&auth.SessionIdle, "session-idle", auth.SessionIdle, "登录会话的空闲超时，0 表示不限制")
+	flag.DurationVar(&auth.RememberTTL, "remember-ttl", auth.RememberTTL, "登录时勾选「记住此设备」的会话有效期")
+	useTLS := flag.Bool("tls", false, "使用 HTTPS；未指定证书文件时在配置目录生成自签名证书")
+	tlsCert := flag.String("tls-cert", "", "HTTPS 证书文件（PEM），与 --tls-key 一起使用")
+	tlsKey := flag.String("tls-key", "", "HTTPS 私钥文件（PEM）")
+	allowRemote := flag.String("allow-remote", "", "允许访问 Web 的其他主机网段（CIDR，逗号分隔），例如 192.168.1.0/24；未指定 --http 时改为监听所有网卡")
+	allowedHosts := flag.String("allowed-hosts", "", "除 localhost 与 IP 地址外允许访问 Web 的主机名，逗号分隔，例如 lwshell.lan")
 	flag.Parse()
+	for _, h := range strings.Split(*allowedHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			auth.AllowedHosts = append(auth.AllowedHosts, h)
+		}
+	}
+	nets, err := auth.ParseAllowRemote(*allowRemote)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--allow-remote:", err)
+		os.Exit(1)
+	}
+	auth.AllowedNets = nets
+	if len(nets) > 0 && !flagSet("http") {
+		*httpAddr = ":" + getListenPort(defaultHTTPAddr)
+	}
 
 	if *connectID != "" {
-		runConnect(*connectID)
+		runConnect(*connectID, *connectUser)
+		return
+	}
+	if *importSSHConfig != "" {
+		runImport(&server.ImportReq{Format: server.FormatSSHConfig, Path: *importSSHConfig, Replace: *importReplace, DryRun: *dryRun})
 		return
 	}
-	runHTTP(*httpAddr)
+	certFile, keyFile := *tlsCert, *tlsKey
+	if (certFile == "") != (keyFile == "") {
+		fmt.Fprintln(os.Stderr, "--tls-cert 与 --tls-key 须同时指定")
+		os.Exit(1)
+	}
+	if *useTLS && certFile == "" {
+		hosts := append([]string{}, auth.AllowedHosts...)
+		if h, _, err := net.SplitHostPort(*httpAddr); err == nil {
+			hosts = append(hosts, h)
+		}
+		var created bool
+		if certFile, keyFile, created, err = tlscert.LoadOrCreate(hosts); err != nil {
+			fmt.Fprintln(os.Stderr, "生成自签名证书失败:", err)
+			os.Exit(1)
+		}
+		if created {
+			fmt.Println("已生成自签名证书:", certFile)
+		}
+	}
+	stopMetrics := metrics.Start(*metricsInterval)
+	auth.StartSessionSweeper(time.Minute)
+	err = runHTTP(*httpAddr, certFile, keyFile)
+	stopMetrics()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-func runConnect(id string) {
+func runConnect(id, actor string) {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	var target *models.Server
-	for i := range cfg.Servers {
-		if cfg.Servers[i].ID == id {
-			target = &cfg.Servers[i]
-			break
-		}
-	}
-	if target == nil {
+	found := cfg.Find(id)
+	if found == nil {
 		fmt.Fprintln(os.Stderr, "server not found:", id)
 		os.Exit(1)
 	}
+	// 使用继承模板后的生效配置连接
+	resolved := cfg.Resolve(*found)
+	target := &resolved
 	// 立即写入「开始连接」日志，避免用户直接关终端时没有记录
-	audit.LogConnectStart(target)
+	audit.LogConnectStart(target, actor)
 	// 在终端中显示当前连接的服务器，并固定窗口标题为服务器名（连接期间会定期刷新，防止被远程覆盖）
 	showServerBanner(target)
 	port := target.Port
@@ -65,14 +138,139 @@ func runConnect(id string) {
 		port = 22
 	}
 	title := fmt.Sprintf("SSH: %s (%s@%s:%d)", target.Name, target.User, target.Host, port)
-	connectErr := ssh.Connect(*target, ssh.ConnectOptions{WindowTitle: title})
-	audit.LogConnect(target, connectErr)
+	jumps, connectErr := ssh.JumpChain(*target, cfg.ResolvedServers())
+	if connectErr == nil {
+		connectErr = ssh.Connect(*target, ssh.ConnectOptions{WindowTitle: title, Jumps: jumps})
+	}
+	audit.LogConnect(target, actor, connectErr)
 	if connectErr != nil {
 		fmt.Fprintln(os.Stderr, connectErr)
 		os.Exit(1)
 	}
 }
 
+// runImport 命令行导入：与 Web 的 /api/import 共用解析与合并逻辑，并打印变更预览
+func runImport(req *server.ImportReq) {
+	src, err := server.ParseImport(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	res, err := server.ImportServers(src, req.Replace, req.DryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	printChanges(res.Changes)
+	if report := res.Report; report != nil {
+		for _, s := range report.Skipped {
+			fmt.Println("跳过:", s)
+		}
+		if len(report.Unsupported) > 0 {
+			fmt.Println("未支持的字段:", strings.Join(report.Unsupported, ", "))
+		}
+	}
+	if req.DryRun {
+		fmt.Printf("预览完成（未写入），导入后共 %d 台服务器\n", res.Count)
+		return
+	}
+	audit.LogChange("import", "", "", "source", "cli", "format", req.Format, "replace", strconv.FormatBool(req.Replace),
+		"changes", strconv.Itoa(len(res.Changes)), "keys_restored", strconv.Itoa(res.KeysRestored))
+	if res.KeysRestored > 0 {
+		fmt.Printf("已恢复 %d 个私钥文件\n", res.KeysRestored)
+	}
+	if res.KnownHostsAdded > 0 {
+		fmt.Printf("已向 known_hosts 追加 %d 行\n", res.KnownHostsAdded)
+	}
+	fmt.Printf("导入完成，共 %d 台服务器\n", res.Count)
+}
+
+// printChanges 逐行打印导入 / 恢复的变更
+func printChanges(changes []server.ImportChange) {
+	for _, c := range changes {
+		line := fmt.Sprintf("%-9s %s (%s)", c.Action, c.Name, c.Host)
+		if len(c.Fields) > 0 {
+			line += " [" + strings.Join(c.Fields, ", ") + "]"
+		}
+		fmt.Println(line)
+	}
+}
+
+// runRestore 命令行恢复快照：lwshell restore 列出快照，lwshell restore [--dry-run] <快照名|latest> 恢复
+func runRestore(args []string) {
+	fset := flag.NewFlagSet("restore", flag.ExitOnError)
+	dryRun := fset.Bool("dry-run", false, "只显示变更，不恢复")
+	// 允许 --dry-run 写在快照名之后
+	var names []string
+	for {
+		_ = fset.Parse(args)
+		if fset.NArg() == 0 {
+			break
+		}
+		names = append(names, fset.Arg(0))
+		args = fset.Args()[1:]
+	}
+	list, err := config.ListBackups()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(names) == 0 {
+		if len(list) == 0 {
+			fmt.Println("没有可用的快照")
+			return
+		}
+		for _, b := range list {
+			fmt.Printf("%s  %s  %d 台服务器\n", b.Name, b.Time.Local().Format("2006-01-02 15:04:05"), b.Servers)
+		}
+		return
+	}
+	name := names[0]
+	if name == "latest" {
+		if len(list) == 0 {
+			fmt.Fprintln(os.Stderr, "没有可用的快照")
+			os.Exit(1)
+		}
+		name = list[0].Name
+	}
+	snap, err := config.LoadBackup(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cur, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	printChanges(server.DiffServers(cur.Servers, snap.Servers))
+	if *dryRun {
+		fmt.Printf("预览完成（未恢复），快照 %s 共 %d 台服务器\n", name, len(snap.Servers))
+		return
+	}
+	if _, err := config.RestoreBackup(name); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	audit.LogChange("backup_restore", "", "", "source", "cli", "name", name, "servers", strconv.Itoa(len(snap.Servers)))
+	fmt.Printf("已恢复快照 %s，共 %d 台服务器\n", name, len(snap.Servers))
+}
+
+// runMigrate 切换存储后端：lwshell migrate <json|sqlite>，复制当前配置与历史快照后切换
+func runMigrate(args []string) {
+	if len(args) != 1 || (args[0] != config.BackendJSON && args[0] != config.BackendSQLite) {
+		fmt.Fprintf(os.Stderr, "用法: lwshell migrate <%s|%s>（当前: %s）\n", config.BackendJSON, config.BackendSQLite, config.Backend())
+		os.Exit(2)
+	}
+	from := config.Backend()
+	n, err := config.Migrate(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("已从 %s 迁移到 %s，共 %d 台服务器；原数据保留，可再次迁移回退\n", from, args[0], n)
+}
+
 // showServerBanner 在终端打印服务器标识，并设置 Terminal 窗口/标签标题
 func showServerBanner(s *models.Server) {
 	port := s.Port
@@ -89,12 +287,17 @@ func showServerBanner(s *models.Server) {
 	fmt.Print(banner)
 }
 
-func runHTTP(addr string) {
+// runHTTP 启动 Web 服务；certFile 非空时使用 HTTPS，收到 Ctrl+C / SIGTERM 时停止接受新请求并返回
+func runHTTP(addr, certFile, keyFile string) error {
 	// 启动前先关闭占用目标端口的进程（避免重复启动需手动关旧服务）
 	if port := getListenPort(addr); port != "" {
 		killProcessOnPort(port)
 		time.Sleep(800 * time.Millisecond)
 	}
+	// 从访问日志补全升级前的最近连接时间（失败不影响启动）
+	if err := audit.BackfillLastConnected(); err != nil {
+		fmt.Fprintln(os.Stderr, "补全最近连接时间失败:", err)
+	}
 
 	mux := http.NewServeMux()
 	// 认证：状态、首次设置密码、登录、登出（无需登录）
@@ -103,18 +306,126 @@ func runHTTP(addr string) {
 	mux.HandleFunc("/api/auth/login", auth.Login)
 	mux.HandleFunc("/api/auth/logout", auth.Logout)
 	mux.HandleFunc("/api/auth/reset", auth.RequireAuth(auth.Reset))
-	// 以下接口需登录
+	// 两步验证：登录第二步只需 Login 下发的临时会话，其余为当前用户的设置
+	mux.HandleFunc("/api/auth/totp/verify", auth.TOTPVerify)
+	mux.HandleFunc("/api/auth/totp", auth.RequireAuth(auth.TOTPAPI))
+	mux.HandleFunc("/api/auth/totp/", auth.RequireAuth(auth.TOTPAPI))
+	// 通行密钥（WebAuthn）：登录无需已登录，注册与管理为当前用户的设置
+	mux.HandleFunc("/api/auth/passkey/", auth.PasskeyLogin)
+	mux.HandleFunc("/api/auth/passkeys", auth.RequireAuth(auth.PasskeysAPI))
+	mux.HandleFunc("/api/auth/passkeys/", auth.RequireAuth(auth.PasskeysAPI))
+	mux.HandleFunc("/api/auth/sessions", auth.RequireAuth(auth.SessionsAPI))
+	mux.HandleFunc("/api/auth/sessions/", auth.RequireAuth(auth.SessionsAPI))
+	// 个人 API 令牌：只能在浏览器登录后管理，脚本以 Authorization: Bearer 调用其他接口
+	mux.HandleFunc("/api/tokens", auth.RequireAuth(auth.TokensAPI))
+	mux.HandleFunc("/api/tokens/", auth.RequireAuth(auth.TokensAPI))
+	// 以下接口需登录；涉及具体服务器的操作由 handler 再按其分组检查权限
 	mux.HandleFunc("/api/servers", auth.RequireAuth(server.ServersAPI))
 	mux.HandleFunc("/api/servers/", auth.RequireAuth(server.ServersAPI))
-	mux.HandleFunc("/api/connect", auth.RequireAuth(server.Connect))
-	mux.HandleFunc("/api/export", auth.RequireAuth(server.Export))
-	mux.HandleFunc("/api/import", auth.RequireAuth(server.Import))
+	mux.HandleFunc("/api/groups/", auth.Require(auth.PermEdit, server.GroupsAPI))
+	mux.HandleFunc("/api/templates", auth.RequireAuth(server.TemplatesAPI))
+	mux.HandleFunc("/api/templates/", auth.RequireAuth(server.TemplatesAPI))
+	mux.HandleFunc("/api/connect", auth.Require(auth.PermConnect, server.Connect))
+	mux.HandleFunc("/api/export", auth.Require(auth.PermExport, server.Export))
+	mux.HandleFunc("/api/import", auth.Require(auth.PermAdmin, server.Import))
+	mux.HandleFunc("/api/metrics", auth.RequireAuth(server.Metrics))
+	mux.HandleFunc("/api/backups", auth.Require(auth.PermAdmin, server.BackupsAPI))
+	mux.HandleFunc("/api/events", auth.Require(auth.PermAdmin, server.Events))
+	// 用户管理（仅管理员）
+	mux.HandleFunc("/api/users", auth.Require(auth.PermAdmin, auth.UsersAPI))
+	mux.HandleFunc("/api/users/", auth.Require(auth.PermAdmin, auth.UsersAPI))
 	webRoot, _ := fs.Sub(webFS, "web")
 	mux.Handle("/", http.FileServer(http.FS(webRoot)))
-	fmt.Println("lwshell Web: http://127.0.0.1" + addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	handler := auth.RestrictClients(auth.CSRF(mux))
+	fmt.Println("lwshell Web:", webURL(addr, certFile != ""))
+	warnExposure(addr, certFile != "")
+	srv := &http.Server{Addr: addr, Handler: handler}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	var err error
+	if certFile != "" {
+		fp, ferr := tlscert.Fingerprint(certFile)
+		if ferr != nil {
+			return ferr
+		}
+		fmt.Println("证书 SHA-256 指纹:", fp)
+		err = srv.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// flagSet 命令行中是否显式指定了该参数
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// listenHost 监听地址中的主机部分，":21008" 为空
+func listenHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// loopbackOnly 监听地址是否只能从本机访问
+func loopbackOnly(addr string) bool {
+	host := listenHost(addr)
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// webURL 启动时打印的访问地址；监听所有网卡时显示本机回环地址
+func webURL(addr string, useTLS bool) string {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	host := listenHost(addr)
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return scheme + "://" + net.JoinHostPort(host, getListenPort(addr))
+}
+
+// warnExposure 监听地址与 --allow-remote 不一致，或允许其他主机以明文 HTTP 访问时在启动时提示
+func warnExposure(addr string, useTLS bool) {
+	remote := !loopbackOnly(addr)
+	switch {
+	case remote && len(auth.AllowedNets) == 0:
+		fmt.Fprintf(os.Stderr, "注意：监听 %s，但未指定 --allow-remote，其他主机的请求将被拒绝\n", addr)
+	case !remote && len(auth.AllowedNets) > 0:
+		fmt.Fprintf(os.Stderr, "注意：已指定 --allow-remote，但只监听本机地址 %s，其他主机无法连接\n", addr)
+	case remote && !useTLS:
+		nets := make([]string, len(auth.AllowedNets))
+		for i, n := range auth.AllowedNets {
+			nets[i] = n.String()
+		}
+		fmt.Fprintln(os.Stderr, "\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
+		fmt.Fprintf(os.Stderr, "  警告：允许 %s 通过明文 HTTP 访问\n", strings.Join(nets, ", "))
+		fmt.Fprintln(os.Stderr, "  登录密码、会话 Cookie 与主机密码将在网络中明文传输，")
+		fmt.Fprintln(os.Stderr, "  请加 --tls 启用 HTTPS，或只在可信网络中使用。")
+		fmt.Fprint(os.Stderr, "!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
 	}
 }
 
@@ -1,12 +1,14 @@
 package audit
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"lwshell/internal/config"
 	"lwshell/internal/models"
 )
 
@@ -45,20 +47,21 @@ func writeLogLine(line string) {
 	_ = f.Close()
 }
 
-// LogConnectStart 在发起 SSH 连接时立即记录（点击「连接」后、ssh.Connect 阻塞前调用）
-func LogConnectStart(s *models.Server) {
+// LogConnectStart 在发起 SSH 连接时立即记录（点击「连接」后、ssh.Connect 阻塞前调用）；actor 为发起连接的 Web 用户
+func LogConnectStart(s *models.Server, actor string) {
 	ts := time.Now().UTC().Format(time.RFC3339)
 	port := s.Port
 	if port <= 0 {
 		port = 22
 	}
-	line := fmt.Sprintf("%s connect id=%s name=%s host=%s port=%d user=%s status=started\n",
-		ts, s.ID, escape(s.Name), s.Host, port, escape(s.User))
+	line := fmt.Sprintf("%s connect id=%s name=%s host=%s port=%d user=%s status=started%s\n",
+		ts, s.ID, escape(s.Name), s.Host, port, escape(s.User), actorField(actor))
 	writeLogLine(line)
+	recordEvent(s, actor, port, "started", nil)
 }
 
 // LogConnect 记录 SSH 连接结束：成功或失败（在 ssh.Connect 返回后调用）
-func LogConnect(s *models.Server, connectErr error) {
+func LogConnect(s *models.Server, actor string, connectErr error) {
 	ts := time.Now().UTC().Format(time.RFC3339)
 	port := s.Port
 	if port <= 0 {
@@ -73,8 +76,154 @@ func LogConnect(s *models.Server, connectErr error) {
 	if connectErr != nil {
 		line += fmt.Sprintf(" err=%s", escape(connectErr.Error()))
 	}
-	line += "\n"
+	line += actorField(actor) + "\n"
 	writeLogLine(line)
+	recordEvent(s, actor, port, status, connectErr)
+	if connectErr == nil {
+		_ = config.Touch(s.ID, time.Now())
+	}
+}
+
+// recordEvent 同时写入存储后端的事件表（SQLite 后端支持按服务器、时间查询；JSON 后端忽略）
+func recordEvent(s *models.Server, actor string, port int, status string, connectErr error) {
+	e := config.Event{
+		Time:     time.Now().UTC(),
+		Action:   "connect",
+		Actor:    actor,
+		ServerID: s.ID,
+		Name:     s.Name,
+		Host:     s.Host,
+		Port:     port,
+		User:     s.User,
+		Status:   status,
+	}
+	if connectErr != nil {
+		e.Err = connectErr.Error()
+	}
+	_ = config.AddEvent(e)
+}
+
+// LogAuth 记录登录、登出、用户管理等认证事件；actor 为操作者（登录失败时为尝试的用户名），remote 为客户端地址，
+// detail 为附加的 key=value 字段
+func LogAuth(action, actor, remote, status, detail string) {
+	ts := time.Now().UTC().Format(time.RFC3339)
+	line := fmt.Sprintf("%s %s remote=%s status=%s%s", ts, action, escape(remote), status, actorField(actor))
+	if detail != "" {
+		line += " " + detail
+	}
+	writeLogLine(line + "\n")
+	_ = config.AddEvent(config.Event{
+		Time:   time.Now().UTC(),
+		Action: action,
+		Actor:  actor,
+		Host:   remote,
+		Status: status,
+		Err:    detail,
+	})
+}
+
+// LogChange 记录对配置的修改（服务器增删改、分组重命名与移动、模板、导入、导出与快照恢复）；actor 为操作的 Web 用户，
+// id 为服务器或模板的 ID（批量操作时为空），kv 为成对的附加字段名与值
+func LogChange(action, actor, id string, kv ...string) {
+	ts := time.Now().UTC().Format(time.RFC3339)
+	line := ts + " " + action
+	if id != "" {
+		line += " id=" + escape(id)
+	}
+	var detail []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		detail = append(detail, kv[i]+"="+escape(kv[i+1]))
+	}
+	line += " status=ok" + actorField(actor)
+	if len(detail) > 0 {
+		line += " " + strings.Join(detail, " ")
+	}
+	writeLogLine(line + "\n")
+	_ = config.AddEvent(config.Event{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Actor:    actor,
+		ServerID: id,
+		Status:   "ok",
+		Err:      strings.Join(detail, " "),
+	})
+}
+
+// actorField 日志行中的操作者字段；命令行直接连接（无 Web 用户）时省略
+func actorField(actor string) string {
+	if actor == "" {
+		return ""
+	}
+	return " actor=" + escape(actor)
+}
+
+// LastConnected 从 access.log 统计每个服务器 ID 最近一次成功连接的时间
+func LastConnected() (map[string]time.Time, error) {
+	p, err := logPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]time.Time{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	out := make(map[string]time.Time)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || fields[1] != "connect" || !strings.HasPrefix(fields[2], "id=") {
+			continue
+		}
+		success := false
+		for _, v := range fields[3:] {
+			if v == "success" {
+				success = true
+				break
+			}
+		}
+		t, err := time.Parse(time.RFC3339, fields[0])
+		if !success || err != nil {
+			continue
+		}
+		id := strings.TrimPrefix(fields[2], "id=")
+		if t.After(out[id]) {
+			out[id] = t
+		}
+	}
+	return out, sc.Err()
+}
+
+// BackfillLastConnected 为尚无最近连接时间的服务器从 access.log 补全（如升级前的连接记录），按 ID 或曾用 ID 匹配
+func BackfillLastConnected() error {
+	last, err := LastConnected()
+	if err != nil || len(last) == 0 {
+		return err
+	}
+	apply := func(cfg *models.Config) bool {
+		changed := false
+		for id, t := range last {
+			t := t
+			if s := cfg.Find(id); s != nil && (s.LastConnected == nil || s.LastConnected.Before(t)) {
+				s.LastConnected = &t
+				changed = true
+			}
+		}
+		return changed
+	}
+	// 先只读检查，没有需要补全的服务器时不写配置
+	cfg, err := config.Load()
+	if err != nil || !apply(cfg) {
+		return err
+	}
+	return config.Update(func(cfg *models.Config) error {
+		apply(cfg)
+		return nil
+	})
 }
 
 func escape(s string) string {
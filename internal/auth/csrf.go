@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"lwshell/internal/audit"
+)
+
+// CSRF 防护：修改类请求须带 X-CSRF-Token 头，其值为 HttpOnly 的 csrfCookie 经服务端密钥签名后的结果，
+// 只能由同源页面从 /api/auth/status 读取；同时校验 Origin / Referer 与 Host，
+// 使其他网站（包括 localhost 上其他端口的页面）以及 DNS 重绑定的域名都无法代替用户发起连接、导入等操作
+const (
+	csrfCookie = "lwshell_csrf"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// AllowedHosts 除 localhost 与 IP 地址外允许访问接口的主机名（不含端口），可由命令行参数设置（见 cmd/lwshell）
+var AllowedHosts []string
+
+// csrfToken 返回与请求的 csrfCookie 对应的令牌；没有该 Cookie 时生成一个并写入响应
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	secret, err := cookieSecret()
+	if err != nil {
+		return "", err
+	}
+	if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+		return signCSRF(secret, c.Value), nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	v := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    v,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return signCSRF(secret, v), nil
+}
+
+func signCSRF(secret []byte, v string) string {
+	return signSessionID(secret, "csrf:"+v)
+}
+
+// validCSRF 校验请求头中的令牌与 csrfCookie 是否匹配
+func validCSRF(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	secret, err := cookieSecret()
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(r.Header.Get(csrfHeader)), []byte(signCSRF(secret, c.Value)))
+}
+
+// allowedHost 判断 Host 是否为 localhost、IP 地址或 AllowedHosts 中的主机名
+func allowedHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || net.ParseIP(host) != nil {
+		return true
+	}
+	for _, h := range AllowedHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin 浏览器发起的请求须来自本服务的页面：Origin（或没有 Origin 时的 Referer）的主机与端口须与 Host 一致；
+// 两者都没有时（命令行工具等）只依靠令牌校验
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site == "cross-site" || site == "same-site" {
+		return false
+	}
+	src := r.Header.Get("Origin")
+	if src == "" {
+		src = r.Header.Get("Referer")
+	}
+	if src == "" {
+		return true
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// CSRF 包装整个 HTTP 服务：/api/ 下的请求须使用允许的 Host，除 GET / HEAD / OPTIONS 外还须通过来源与令牌校验，否则返回 403；
+// 持有效 API 令牌（Authorization: Bearer）的请求免于来源与令牌校验（/api/auth/* 除外），Host 校验不例外
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !allowedHost(r.Host) {
+			audit.LogAuth("csrf", "", clientIP(r), "failure", "reason=host host="+r.Host)
+			http.Error(w, "不允许通过该主机名访问，请使用 --allowed-hosts 添加", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		// 浏览器不会自动附带 Bearer 令牌，持有效令牌的请求由 RequireAuth 按令牌认证，无需校验来源；
+		// 只带 Authorization 头不够，否则伪造的无效令牌即可绕过校验。/api/auth/* 不接受令牌，始终校验
+		if !strings.HasPrefix(r.URL.Path, "/api/auth/") {
+			if u, _ := tokenUser(r); u != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		reason := ""
+		if !sameOrigin(r) {
+			reason = "origin"
+		} else if !validCSRF(r) {
+			reason = "token"
+		}
+		if reason != "" {
+			audit.LogAuth("csrf", "", clientIP(r), "failure", "reason="+reason+" path="+r.URL.Path)
+			http.Error(w, "请求来源校验失败，请刷新页面后重试", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
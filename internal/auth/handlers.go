@@ -2,14 +2,25 @@ package auth
 
 import (
 	"encoding/json"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+
+	"lwshell/internal/audit"
 )
 
 // StatusResp 认证状态
 type StatusResp struct {
-	NeedSetup bool `json:"need_setup"` // 未设置主密码，需首次设置
-	LoggedIn  bool `json:"logged_in"`  // 已登录
+	NeedSetup bool              `json:"need_setup"`      // 未设置主密码，需首次设置
+	LoggedIn  bool              `json:"logged_in"`       // 已登录
+	NeedTOTP  bool              `json:"need_totp"`       // 密码已验证，等待输入两步验证码（此时 User 为该用户）
+	User      string            `json:"user,omitempty"`  // 当前用户
+	Role      string            `json:"role,omitempty"`  // 当前用户角色
+	Perms     map[string][]Perm `json:"perms,omitempty"` // 当前用户的有效权限，键为分组路径，"*" 表示全部分组
+	LockedFor int               `json:"locked_seconds"`  // 密码错误次数过多，本机地址还需等待的秒数，0 表示未锁定
+	CSRFToken string            `json:"csrf_token"`      // 修改类请求须放在 X-CSRF-Token 头中（见 csrf.go）
 }
 
 // Status 返回当前认证状态。
@@ -20,29 +31,40 @@ func Status(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
+	token, err := csrfToken(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	hasPwd, err := HasPassword()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if !hasPwd {
 		// 仅首次：本机尚未存在主密码哈希文件，需设置主密码
-		_ = json.NewEncoder(w).Encode(StatusResp{NeedSetup: true, LoggedIn: false})
+		_ = json.NewEncoder(w).Encode(StatusResp{NeedSetup: true, LoggedIn: false, CSRFToken: token})
 		return
 	}
 	// 已设置过主密码：仅需登录，不再出现设置密码界面
-	_, ok := getSession(r)
-	_ = json.NewEncoder(w).Encode(StatusResp{NeedSetup: false, LoggedIn: ok})
+	resp := StatusResp{LockedFor: int(math.Ceil(lockedFor(clientIP(r)).Seconds())), CSRFToken: token}
+	if u := sessionUser(r); u != nil {
+		resp.LoggedIn, resp.User, resp.Role, resp.Perms = true, u.Name, u.Role, u.PermMap()
+	} else if _, s, ok := pendingSession(r); ok {
+		resp.NeedTOTP, resp.User = true, s.User
+	}
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
-// SetupReq 首次设置主密码
+// SetupReq 首次设置主密码；Username 为空时管理员用户名为 admin
 type SetupReq struct {
+	Username string `json:"username"`
 	Password string `json:"password"`
 	Confirm  string `json:"confirm"`
 }
 
-// Setup 仅首次可用：设置主密码并登录。一旦本机已存在主密码哈希，此接口拒绝再次设置。
+// Setup 仅首次可用：创建第一个管理员用户。一旦本机已存在任一用户（或旧版主密码），此接口拒绝再次设置。
 func Setup(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -69,25 +91,29 @@ func Setup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "两次密码不一致", http.StatusBadRequest)
 		return
 	}
-	if err := SetPassword(req.Password); err != nil {
-		if err == ErrPasswordTooShort {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	name := strings.TrimSpace(req.Username)
+	if name == "" {
+		name = DefaultUser
+	}
+	if err := CreateUser(name, req.Password, RoleAdmin, nil); err != nil {
+		writeUserError(w, err)
 		return
 	}
+	audit.LogAuth("setup", name, clientIP(r), "ok", "")
 	// 设置成功后不创建会话，让用户跳转到登录页用新密码登录
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// LoginReq 登录
+// LoginReq 登录；Username 为空时按 admin 登录（兼容旧版只有主密码的登录方式）
 type LoginReq struct {
+	Username string `json:"username"`
 	Password string `json:"password"`
+	Remember bool   `json:"remember"` // 记住此设备
 }
 
-// Login 验证主密码并创建会话
+// Login 验证用户名与密码并创建会话；用户启用了两步验证时只创建临时会话并返回 {"status":"totp_required"}，
+// 由前端继续调用 /api/auth/totp/verify。连续失败过多时返回 429（见 lockout.go）
 func Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -98,16 +124,36 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	ok, err := VerifyPassword(strings.TrimSpace(req.Password))
+	name := strings.TrimSpace(req.Username)
+	if name == "" {
+		name = DefaultUser
+	}
+	if checkLocked(w, r, "login", name) {
+		return
+	}
+	u, err := VerifyUser(name, strings.TrimSpace(req.Password))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if !ok {
-		http.Error(w, "密码错误", http.StatusUnauthorized)
+	if u == nil {
+		failAttempt(r, "login", name)
+		http.Error(w, "用户名或密码错误", http.StatusUnauthorized)
 		return
 	}
-	_, err = createSession(w)
+	if u.TOTPSecret != "" {
+		audit.LogAuth("login", u.Name, clientIP(r), "password_ok", "")
+		if _, err := createPendingSession(w, r, u.Name, req.Remember); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "totp_required"})
+		return
+	}
+	audit.LogAuth("login", u.Name, clientIP(r), "success", "")
+	recordSuccess(clientIP(r))
+	_, err = createSession(w, r, u.Name, req.Remember)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -122,19 +168,22 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s, ok := getSession(r); ok {
+		audit.LogAuth("logout", s.User, clientIP(r), "ok", "")
+	}
 	destroySession(w, r)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// ResetReq 重设主密码（需已登录）
+// ResetReq 修改当前用户的密码（需已登录）
 type ResetReq struct {
 	CurrentPassword string `json:"current_password"`
 	NewPassword     string `json:"new_password"`
 	Confirm         string `json:"confirm"`
 }
 
-// Reset 重设主密码：校验当前密码后写入新密码哈希
+// Reset 修改当前用户的密码：校验当前密码后写入新密码哈希，并注销该用户在其他设备上的全部会话
 func Reset(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -152,27 +201,41 @@ func Reset(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "请输入当前密码", http.StatusBadRequest)
 		return
 	}
-	ok, err := VerifyPassword(cur)
+	name := Actor(r)
+	if checkLocked(w, r, "reset", name) {
+		return
+	}
+	u, err := VerifyUser(name, cur)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if !ok {
+	if u == nil {
+		failAttempt(r, "reset", name)
 		http.Error(w, "当前密码错误", http.StatusUnauthorized)
 		return
 	}
+	recordSuccess(clientIP(r))
 	if newPwd != confirm {
 		http.Error(w, "两次新密码不一致", http.StatusBadRequest)
 		return
 	}
-	if err := SetPassword(newPwd); err != nil {
-		if err == ErrPasswordTooShort {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := SetUserPassword(u.Name, newPwd); err != nil {
+		writeUserError(w, err)
 		return
 	}
+	current, _ := cookieSessionKey(r)
+	n := destroyUserSessions(u.Name, current)
+	audit.LogAuth("reset", u.Name, clientIP(r), "success", "revoked="+strconv.Itoa(n))
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
+
+// clientIP 客户端地址（不含端口）
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
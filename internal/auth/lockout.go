@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"lwshell/internal/audit"
+)
+
+// 密码猜测限制：按客户端 IP 与全局分别统计连续失败次数，超过阈值后指数增长地锁定（登录、重设密码、两步验证码共用）
+const (
+	ipFreeFailures     = 5                // 每个 IP 允许的连续失败次数，之后开始锁定
+	ipBaseLock         = 30 * time.Second // 第一次锁定时长，之后每多失败一次翻倍
+	ipMaxLock          = time.Hour
+	globalFreeFailures = 30 // 全局（所有 IP 合计）允许的连续失败次数，防止从多个地址分散猜测
+	globalBaseLock     = 5 * time.Second
+	globalMaxLock      = 5 * time.Minute
+	failureWindow      = 15 * time.Minute // 超过该时间没有新的失败则清零
+)
+
+// failState 一个计数对象（某个 IP 或全局）的连续失败状态
+type failState struct {
+	Failures    int
+	Last        time.Time
+	LockedUntil time.Time
+}
+
+var (
+	lockMu       sync.Mutex
+	ipFailures   = make(map[string]*failState)
+	globalFailed failState
+)
+
+// lockDuration 第 failures 次失败后的锁定时长：未超过 free 次为 0，之后从 base 开始翻倍，不超过 max
+func lockDuration(failures, free int, base, max time.Duration) time.Duration {
+	if failures <= free {
+		return 0
+	}
+	exp := failures - free - 1
+	if exp > 30 {
+		return max
+	}
+	d := base * time.Duration(math.Pow(2, float64(exp)))
+	if d > max || d <= 0 {
+		return max
+	}
+	return d
+}
+
+// expire 超过 failureWindow 没有新的失败且未处于锁定中时清零
+func (s *failState) expire(now time.Time) {
+	if now.Sub(s.Last) > failureWindow && now.After(s.LockedUntil) {
+		*s = failState{}
+	}
+}
+
+// lockedFor 返回 ip 还需等待的时间（IP 与全局锁定取较长者），未锁定为 0
+func lockedFor(ip string) time.Duration {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	now := time.Now()
+	wait := globalFailed.LockedUntil.Sub(now)
+	if s, ok := ipFailures[ip]; ok {
+		if d := s.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// recordFailure 记录一次失败，返回新产生的锁定（scope 为 ip 或 global，未锁定时 d 为 0）
+func recordFailure(ip string) (scope string, d time.Duration) {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	now := time.Now()
+	for k, s := range ipFailures {
+		if s.expire(now); s.Failures == 0 {
+			delete(ipFailures, k)
+		}
+	}
+	s, ok := ipFailures[ip]
+	if !ok {
+		s = &failState{}
+		ipFailures[ip] = s
+	}
+	s.Failures++
+	s.Last = now
+	if ipd := lockDuration(s.Failures, ipFreeFailures, ipBaseLock, ipMaxLock); ipd > 0 {
+		s.LockedUntil = now.Add(ipd)
+		scope, d = "ip", ipd
+	}
+	globalFailed.expire(now)
+	globalFailed.Failures++
+	globalFailed.Last = now
+	if gd := lockDuration(globalFailed.Failures, globalFreeFailures, globalBaseLock, globalMaxLock); gd > 0 {
+		globalFailed.LockedUntil = now.Add(gd)
+		if gd > d {
+			scope, d = "global", gd
+		}
+	}
+	return scope, d
+}
+
+// recordSuccess 验证成功后清零该 IP 的失败次数（全局计数随时间窗口自然清零）
+func recordSuccess(ip string) {
+	lockMu.Lock()
+	delete(ipFailures, ip)
+	lockMu.Unlock()
+}
+
+// checkLocked 处于锁定中时写入 429 与 Retry-After 并记录审计日志，返回 true 表示请求已被拒绝
+func checkLocked(w http.ResponseWriter, r *http.Request, action, actor string) bool {
+	wait := lockedFor(clientIP(r))
+	if wait <= 0 {
+		return false
+	}
+	secs := int(math.Ceil(wait.Seconds()))
+	audit.LogAuth(action, actor, clientIP(r), "locked", "retry_after="+strconv.Itoa(secs))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, fmt.Sprintf("尝试次数过多，请 %d 秒后再试", secs), http.StatusTooManyRequests)
+	return true
+}
+
+// failAttempt 记录一次失败并写入审计日志；因此触发锁定时另记一条 lockout
+func failAttempt(r *http.Request, action, actor string) {
+	ip := clientIP(r)
+	audit.LogAuth(action, actor, ip, "failure", "")
+	if scope, d := recordFailure(ip); d > 0 {
+		audit.LogAuth("lockout", actor, ip, "locked", fmt.Sprintf("scope=%s seconds=%d trigger=%s", scope, int(math.Ceil(d.Seconds())), action))
+	}
+}
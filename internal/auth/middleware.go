@@ -1,18 +1,97 @@
 package auth
 
 import (
+	"context"
 	"net/http"
+	"strings"
+
+	"lwshell/internal/audit"
 )
 
-// RequireAuth 包装 handler，未登录返回 401
+type ctxKey struct{}
+
+// RequireAuth 包装 handler，未登录（或会话所属用户已被删除）返回 401；通过后可用 CurrentUser 取得当前用户。
+// 带 Authorization: Bearer 的请求只按 API 令牌认证（见 tokens.go），不再读取会话 Cookie
 func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := getSession(r); !ok {
+		var u *User
+		if _, ok := bearerToken(r); ok {
+			var t *APIToken
+			if u, t = tokenUser(r); u == nil {
+				audit.LogAuth("token", "", clientIP(r), "failure", "path="+r.URL.Path)
+			} else if !tokenAllowed(r, t) {
+				Forbidden(w)
+				return
+			}
+		} else {
+			u = sessionUser(r)
+		}
+		if u == nil {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
 			_, _ = w.Write([]byte(`{"error":"unauthorized"}`))
 			return
 		}
+		next(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, u)))
+	}
+}
+
+// Require 在 RequireAuth 的基础上要求用户至少在一个分组中拥有 perm，否则返回 403；
+// 与具体服务器相关的操作还需由 handler 调用 Can 按分组检查
+func Require(perm Perm, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if !CurrentUser(r).CanAny(perm) {
+			Forbidden(w)
+			return
+		}
 		next(w, r)
+	})
+}
+
+// Forbidden 写入 403
+func Forbidden(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write([]byte(`{"error":"forbidden"}`))
+}
+
+// CurrentUser 返回 RequireAuth 放入请求上下文的当前用户；未经过 RequireAuth 时返回 nil
+func CurrentUser(r *http.Request) *User {
+	u, _ := r.Context().Value(ctxKey{}).(*User)
+	return u
+}
+
+// Can 判断当前用户能否对 group 分组中的服务器执行 perm
+func Can(r *http.Request, perm Perm, group string) bool {
+	u := CurrentUser(r)
+	return u != nil && u.Can(perm, group)
+}
+
+// Actor 当前用户名，用于审计日志；未登录时为空
+func Actor(r *http.Request) string {
+	if u := CurrentUser(r); u != nil {
+		return u.Name
+	}
+	return ""
+}
+
+// tokenAllowed API 令牌不能管理登录、会话与令牌本身；只读令牌只能调用 GET 接口
+func tokenAllowed(r *http.Request, t *APIToken) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/auth/") || strings.HasPrefix(r.URL.Path, "/api/tokens") {
+		return false
+	}
+	return t.Scope != ScopeRead || r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// sessionUser 按会话 cookie 查找当前用户；每次都重新读取用户信息，角色与授权的修改立即生效
+func sessionUser(r *http.Request) *User {
+	s, ok := getSession(r)
+	if !ok || s.Pending {
+		return nil
+	}
+	u, err := FindUser(s.User)
+	if err != nil {
+		return nil
 	}
+	return u
 }
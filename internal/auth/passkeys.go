@@ -0,0 +1,502 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"lwshell/internal/audit"
+	"lwshell/internal/config"
+)
+
+// Passkey 一个已注册的通行密钥（WebAuthn 凭据）；PublicKey 为 PKIX DER 编码的公钥
+type Passkey struct {
+	ID        string     `json:"id"` // 凭据 ID（base64url）
+	User      string     `json:"user"`
+	Name      string     `json:"name"`
+	PublicKey []byte     `json:"public_key"`
+	Alg       int        `json:"alg"`
+	SignCount uint32     `json:"sign_count"`
+	Created   time.Time  `json:"created"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+const (
+	challengeTTL  = 5 * time.Minute
+	maxChallenges = 1000 // 登录的 begin 接口无需登录，限制未完成的 challenge 数量
+	webauthnWait  = 120000
+)
+
+var (
+	errPasskeyNotFound = errors.New("通行密钥不存在")
+	errPasskeyExists   = errors.New("该通行密钥已注册")
+	errChallenge       = errors.New("challenge 无效或已过期，请重试")
+	passkeysMu         sync.Mutex
+
+	challenges   = make(map[string]pendingChallenge)
+	challengesMu sync.Mutex
+)
+
+// pendingChallenge 已下发、尚未使用的 challenge；每个只能使用一次
+type pendingChallenge struct {
+	Kind    string // register / login
+	User    string // 注册时为当前用户
+	Expires time.Time
+}
+
+func newChallenge(kind, user string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ch := b64url.EncodeToString(b)
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+	now := time.Now()
+	for k, c := range challenges {
+		if now.After(c.Expires) {
+			delete(challenges, k)
+		}
+	}
+	if len(challenges) >= maxChallenges {
+		return "", errors.New("too many pending challenges")
+	}
+	challenges[ch] = pendingChallenge{Kind: kind, User: user, Expires: now.Add(challengeTTL)}
+	return ch, nil
+}
+
+// takeChallenge 取出并作废 challenge；kind 与用户（注册时）须一致
+func takeChallenge(ch, kind, user string) bool {
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+	c, ok := challenges[ch]
+	if !ok {
+		return false
+	}
+	delete(challenges, ch)
+	return c.Kind == kind && strings.EqualFold(c.User, user) && time.Now().Before(c.Expires)
+}
+
+// relyingParty 由请求推导 RP ID（不含端口的主机名）与来源；通行密钥与访问时使用的主机名绑定
+func relyingParty(r *http.Request) (rpID, origin string) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	rpID = r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		rpID = h
+	}
+	return rpID, scheme + "://" + r.Host
+}
+
+// userHandle WebAuthn 的 user.id：不直接使用用户名
+func userHandle(name string) string {
+	sum := sha256.Sum256([]byte("lwshell:" + strings.ToLower(name)))
+	return b64url.EncodeToString(sum[:16])
+}
+
+func passkeysPath() (string, error) {
+	dir, err := authDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "passkeys.json"), nil
+}
+
+type passkeysFile struct {
+	Passkeys []Passkey `json:"passkeys"`
+}
+
+func loadPasskeys() ([]Passkey, error) {
+	p, err := passkeysPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f passkeysFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return f.Passkeys, nil
+}
+
+// updatePasskeys 在锁内读取、修改并保存（先写临时文件再重命名）
+func updatePasskeys(fn func(keys []Passkey) ([]Passkey, error)) error {
+	passkeysMu.Lock()
+	defer passkeysMu.Unlock()
+	keys, err := loadPasskeys()
+	if err != nil {
+		return err
+	}
+	if keys, err = fn(keys); err != nil {
+		return err
+	}
+	p, err := passkeysPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(passkeysFile{Passkeys: keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(p, data, 0600)
+}
+
+// userPasskeys 返回某个用户的通行密钥；name 为空时返回全部
+func userPasskeys(name string) ([]Passkey, error) {
+	passkeysMu.Lock()
+	defer passkeysMu.Unlock()
+	keys, err := loadPasskeys()
+	if err != nil {
+		return nil, err
+	}
+	out := []Passkey{}
+	for _, k := range keys {
+		if name == "" || strings.EqualFold(k.User, name) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// deleteUserPasskeys 删除用户时一并删除其通行密钥
+func deleteUserPasskeys(name string) error {
+	return updatePasskeys(func(keys []Passkey) ([]Passkey, error) {
+		out := keys[:0]
+		for _, k := range keys {
+			if !strings.EqualFold(k.User, name) {
+				out = append(out, k)
+			}
+		}
+		return out, nil
+	})
+}
+
+// credentialDescriptor 对应 WebAuthn 的 PublicKeyCredentialDescriptor，id 为 base64url，由前端转为 ArrayBuffer
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+func descriptors(keys []Passkey) []credentialDescriptor {
+	out := []credentialDescriptor{}
+	for _, k := range keys {
+		out = append(out, credentialDescriptor{Type: "public-key", ID: k.ID})
+	}
+	return out
+}
+
+// PasskeyResp 对外暴露的通行密钥信息
+type PasskeyResp struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+// PasskeyRegisterReq 注册第二步：浏览器返回的凭据（均为 base64url）与显示名称
+type PasskeyRegisterReq struct {
+	Name              string `json:"name"`
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AttestationObject string `json:"attestation_object"`
+}
+
+// PasskeysAPI 当前用户的通行密钥（路由需用 RequireAuth 包装）：
+// GET /api/auth/passkeys 列出；POST /api/auth/passkeys/register/begin 返回 navigator.credentials.create 的参数；
+// POST /api/auth/passkeys/register/finish 校验并保存；DELETE /api/auth/passkeys/:id 删除
+func PasskeysAPI(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/auth/passkeys"), "/")
+	u := CurrentUser(r)
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		keys, err := userPasskeys(u.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out := make([]PasskeyResp, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, PasskeyResp{ID: k.ID, Name: k.Name, Created: k.Created, LastUsed: k.LastUsed})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"passkeys": out})
+	case action == "register/begin" && r.Method == http.MethodPost:
+		registerBegin(w, r, u)
+	case action == "register/finish" && r.Method == http.MethodPost:
+		registerFinish(w, r, u)
+	case action != "" && r.Method == http.MethodDelete:
+		err := updatePasskeys(func(keys []Passkey) ([]Passkey, error) {
+			for i, k := range keys {
+				if k.ID == action && strings.EqualFold(k.User, u.Name) {
+					return append(keys[:i], keys[i+1:]...), nil
+				}
+			}
+			return nil, errPasskeyNotFound
+		})
+		if err != nil {
+			writePasskeyError(w, err)
+			return
+		}
+		audit.LogAuth("passkey_delete", u.Name, clientIP(r), "ok", "")
+		writeOK(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func registerBegin(w http.ResponseWriter, r *http.Request, u *User) {
+	ch, err := newChallenge("register", u.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	keys, err := userPasskeys(u.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rpID, _ := relyingParty(r)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"challenge": ch,
+		"rp":        map[string]string{"id": rpID, "name": "lwshell"},
+		"user":      map[string]string{"id": userHandle(u.Name), "name": u.Name, "displayName": u.Name},
+		"pubKeyCredParams": []map[string]interface{}{
+			{"type": "public-key", "alg": coseES256},
+			{"type": "public-key", "alg": coseEdDSA},
+			{"type": "public-key", "alg": coseRS256},
+		},
+		"timeout":                webauthnWait,
+		"attestation":            "none",
+		"authenticatorSelection": map[string]string{"residentKey": "preferred", "userVerification": "preferred"},
+		"excludeCredentials":     descriptors(keys),
+	})
+}
+
+func registerFinish(w http.ResponseWriter, r *http.Request, u *User) {
+	var req PasskeyRegisterReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	cdRaw, err1 := b64url.DecodeString(req.ClientDataJSON)
+	attRaw, err2 := b64url.DecodeString(req.AttestationObject)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "invalid base64url", http.StatusBadRequest)
+		return
+	}
+	rpID, origin := relyingParty(r)
+	ch, err := parseClientData(cdRaw, "webauthn.create", origin)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !takeChallenge(ch, "register", u.Name) {
+		http.Error(w, errChallenge.Error(), http.StatusBadRequest)
+		return
+	}
+	ad, err := parseAttestation(attRaw, rpID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(ad.PublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := b64url.EncodeToString(ad.CredID)
+	name := strings.TrimSpace(req.Name)
+	err = updatePasskeys(func(keys []Passkey) ([]Passkey, error) {
+		n := 1
+		for _, k := range keys {
+			if k.ID == id {
+				return nil, errPasskeyExists
+			}
+			if strings.EqualFold(k.User, u.Name) {
+				n++
+			}
+		}
+		if name == "" {
+			name = fmt.Sprintf("通行密钥 %d", n)
+		}
+		return append(keys, Passkey{ID: id, User: u.Name, Name: name, PublicKey: der, Alg: ad.Alg, SignCount: ad.SignCount, Created: time.Now().UTC()}), nil
+	})
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	audit.LogAuth("passkey_register", u.Name, clientIP(r), "ok", "name="+strings.ReplaceAll(name, " ", "_"))
+	writeOK(w)
+}
+
+// PasskeyLoginReq 登录第二步：浏览器返回的断言（均为 base64url）
+type PasskeyLoginReq struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+	Remember          bool   `json:"remember"` // 记住此设备
+}
+
+// PasskeyLogin 用通行密钥登录（无需已登录）：
+// POST /api/auth/passkey/begin {"username":可选} 返回 navigator.credentials.get 的参数（未填用户名时由浏览器列出可用的通行密钥）；
+// POST /api/auth/passkey/finish 校验签名后创建会话。认证器未验证用户（UV）且账号启用了两步验证时，仍需输入验证码
+func PasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/auth/passkey"), "/") {
+	case "begin":
+		loginBegin(w, r)
+	case "finish":
+		loginFinish(w, r)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func loginBegin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	ch, err := newChallenge("login", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	allow := []credentialDescriptor{}
+	if name := strings.TrimSpace(req.Username); name != "" {
+		keys, err := userPasskeys(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		allow = descriptors(keys)
+	}
+	rpID, _ := relyingParty(r)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"challenge":        ch,
+		"rpId":             rpID,
+		"timeout":          webauthnWait,
+		"userVerification": "preferred",
+		"allowCredentials": allow,
+	})
+}
+
+func loginFinish(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	cdRaw, err1 := b64url.DecodeString(req.ClientDataJSON)
+	adRaw, err2 := b64url.DecodeString(req.AuthenticatorData)
+	sig, err3 := b64url.DecodeString(req.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		http.Error(w, "invalid base64url", http.StatusBadRequest)
+		return
+	}
+	rpID, origin := relyingParty(r)
+	ch, err := parseClientData(cdRaw, "webauthn.get", origin)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !takeChallenge(ch, "login", "") {
+		http.Error(w, errChallenge.Error(), http.StatusBadRequest)
+		return
+	}
+	ad, err := parseAuthData(adRaw, rpID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var key Passkey
+	err = updatePasskeys(func(keys []Passkey) ([]Passkey, error) {
+		for i := range keys {
+			if keys[i].ID != req.ID {
+				continue
+			}
+			k := &keys[i]
+			if err := verifyAssertion(k.PublicKey, adRaw, cdRaw, sig); err != nil {
+				return nil, err
+			}
+			// 签名计数不增反减说明认证器可能被复制（不支持计数的认证器始终为 0）
+			if (ad.SignCount != 0 || k.SignCount != 0) && ad.SignCount <= k.SignCount {
+				return nil, errors.New("签名计数异常，通行密钥可能已被复制")
+			}
+			now := time.Now().UTC()
+			k.SignCount, k.LastUsed = ad.SignCount, &now
+			key = *k
+			return keys, nil
+		}
+		return nil, errPasskeyNotFound
+	})
+	if err != nil {
+		audit.LogAuth("login_passkey", "", clientIP(r), "failure", "")
+		http.Error(w, "通行密钥验证失败: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	u, err := FindUser(key.User)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if u.TOTPSecret != "" && ad.Flags&flagUserVerified == 0 {
+		audit.LogAuth("login_passkey", u.Name, clientIP(r), "passkey_ok", "")
+		if _, err := createPendingSession(w, r, u.Name, req.Remember); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "totp_required"})
+		return
+	}
+	audit.LogAuth("login_passkey", u.Name, clientIP(r), "success", "")
+	if _, err := createSession(w, r, u.Name, req.Remember); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// writePasskeyError 不存在 404，重复注册 409
+func writePasskeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPasskeyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errPasskeyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"lwshell/internal/audit"
+)
+
+// AllowedNets 除本机回环地址外允许访问 Web 的客户端网段，由 --allow-remote 设置（见 cmd/lwshell）；为空时只允许本机访问
+var AllowedNets []*net.IPNet
+
+// ParseAllowRemote 解析逗号分隔的 CIDR 列表，单个 IP 视为 /32（IPv6 为 /128）
+func ParseAllowRemote(s string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的地址: %s", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", v)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// clientAllowed 本机回环地址始终允许，其他地址须在 AllowedNets 中
+func clientAllowed(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	if addr.IsLoopback() {
+		return true
+	}
+	for _, n := range AllowedNets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestrictClients 包装整个 HTTP 服务：不在允许范围内的客户端地址一律返回 403（页面与接口都不可访问）
+func RestrictClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !clientAllowed(ip) {
+			// 只记录接口请求，避免页面资源请求刷满访问日志
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				audit.LogAuth("remote_denied", "", ip, "failure", "path="+r.URL.Path)
+			}
+			http.Error(w, "该地址不允许访问，请在启动参数 --allow-remote 中添加", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
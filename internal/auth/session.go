@@ -1,24 +1,190 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"lwshell/internal/config"
 )
 
 const (
-	cookieName   = "ssh_manager_session"
-	sessionTTL   = 24 * time.Hour
-	cookieMaxAge = 86400 // 24h in seconds
+	cookieName = "ssh_manager_session"
+
+	pendingTTL         = 5 * time.Minute // 密码已验证、等待输入验证码的有效期
+	maxPendingAttempts = 5               // 等待验证码期间允许输错的次数，超过后需重新输入密码
+	touchInterval      = time.Minute     // 最近访问时间的记录精度，避免每个请求都标记为需要保存
 )
 
+// 会话有效期，可由命令行参数修改（见 cmd/lwshell）
+var (
+	SessionTTL  = 24 * time.Hour      // 绝对有效期：登录后最长保持多久
+	SessionIdle = 2 * time.Hour       // 空闲超时：超过该时间没有访问即失效，0 表示不限制
+	RememberTTL = 30 * 24 * time.Hour // 勾选「记住此设备」时的绝对有效期，不受空闲超时限制
+)
+
+// session 一个登录会话；Pending 表示已通过密码、尚未通过两步验证，此时不能访问受保护接口。
+// 会话保存在 sessions.json 中，键为会话 ID 的 SHA-256，文件泄露也无法据此伪造 Cookie
+type session struct {
+	User      string    `json:"user"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+	Expires   time.Time `json:"expires"`
+	IP        string    `json:"ip"`         // 最近一次访问的客户端地址
+	UserAgent string    `json:"user_agent"` // 登录时的浏览器
+	Remember  bool      `json:"remember,omitempty"`
+	Pending   bool      `json:"pending,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+}
+
+// valid 未超过绝对有效期，且（未勾选记住此设备时）未超过空闲超时
+func (s session) valid(now time.Time) bool {
+	if !now.Before(s.Expires) {
+		return false
+	}
+	if s.Remember || s.Pending || SessionIdle <= 0 {
+		return true
+	}
+	return now.Sub(s.LastSeen) <= SessionIdle
+}
+
 var (
-	sessions   = make(map[string]time.Time)
-	sessionsMu sync.RWMutex
+	sessions       map[string]session // nil 表示尚未从 sessions.json 读取
+	sessionsDirty  bool               // 有尚未保存的最近访问时间
+	sessionsMu     sync.Mutex
+	sessionSecret  []byte
+	sessionKeyOnce sync.Once
+	sessionKeyErr  error
 )
 
+func sessionsPath() (string, error) {
+	dir, err := authDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions.json"), nil
+}
+
+type sessionsFile struct {
+	Sessions map[string]session `json:"sessions"`
+}
+
+// loadSessionsLocked 首次使用时读取 sessions.json（调用方持有 sessionsMu）；文件损坏时丢弃全部会话
+func loadSessionsLocked() {
+	if sessions != nil {
+		return
+	}
+	sessions = make(map[string]session)
+	p, err := sessionsPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return
+	}
+	var f sessionsFile
+	if json.Unmarshal(data, &f) != nil {
+		return
+	}
+	now := time.Now()
+	for k, s := range f.Sessions {
+		if s.valid(now) {
+			sessions[k] = s
+		}
+	}
+}
+
+// saveSessionsLocked 先写临时文件再重命名（调用方持有 sessionsMu）
+func saveSessionsLocked() error {
+	p, err := sessionsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sessionsFile{Sessions: sessions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := config.WriteFileAtomic(p, data, 0600); err != nil {
+		return err
+	}
+	sessionsDirty = false
+	return nil
+}
+
+// cookieSecret 用于签名会话 Cookie 的密钥，首次使用时生成并保存在 .session_key（0600）
+func cookieSecret() ([]byte, error) {
+	sessionKeyOnce.Do(func() {
+		dir, err := authDir()
+		if err != nil {
+			sessionKeyErr = err
+			return
+		}
+		p := filepath.Join(dir, ".session_key")
+		if data, err := os.ReadFile(p); err == nil {
+			if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+				sessionSecret = key
+				return
+			}
+		}
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			sessionKeyErr = err
+			return
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			sessionKeyErr = err
+			return
+		}
+		if err := config.WriteFileAtomic(p, []byte(hex.EncodeToString(key)), 0600); err != nil {
+			sessionKeyErr = err
+			return
+		}
+		sessionSecret = key
+	})
+	return sessionSecret, sessionKeyErr
+}
+
+func signSessionID(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return b64url.EncodeToString(mac.Sum(nil))
+}
+
+// sessionKey 会话在 sessions.json 中的键
+func sessionKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// cookieSessionKey 校验会话 Cookie（"ID.签名"）的签名，返回会话的键
+func cookieSessionKey(r *http.Request) (string, bool) {
+	c, err := r.Cookie(cookieName)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	id, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return "", false
+	}
+	key, err := cookieSecret()
+	if err != nil || !hmac.Equal([]byte(sig), []byte(signSessionID(key, id))) {
+		return "", false
+	}
+	return sessionKey(id), true
+}
+
 func newSessionID() (string, error) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -27,45 +193,159 @@ func newSessionID() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-func createSession(w http.ResponseWriter) (string, error) {
+// createSession 登录成功后创建会话；remember 为「记住此设备」，此时 Cookie 在浏览器关闭后仍保留
+func createSession(w http.ResponseWriter, r *http.Request, user string, remember bool) (string, error) {
+	ttl := SessionTTL
+	if remember {
+		ttl = RememberTTL
+	}
+	return startSession(w, r, session{User: user, Expires: time.Now().Add(ttl), Remember: remember})
+}
+
+// createPendingSession 密码正确但需要两步验证时创建的临时会话，验证通过后按 remember 换发正式会话
+func createPendingSession(w http.ResponseWriter, r *http.Request, user string, remember bool) (string, error) {
+	return startSession(w, r, session{User: user, Expires: time.Now().Add(pendingTTL), Remember: remember, Pending: true})
+}
+
+func startSession(w http.ResponseWriter, r *http.Request, s session) (string, error) {
+	secret, err := cookieSecret()
+	if err != nil {
+		return "", err
+	}
 	id, err := newSessionID()
 	if err != nil {
 		return "", err
 	}
+	now := time.Now()
+	s.Created, s.LastSeen = now, now
+	s.IP, s.UserAgent = clientIP(r), r.UserAgent()
+	if len(s.UserAgent) > 256 {
+		s.UserAgent = s.UserAgent[:256]
+	}
+	key := sessionKey(id)
 	sessionsMu.Lock()
-	sessions[id] = time.Now().Add(sessionTTL)
+	loadSessionsLocked()
+	sessions[key] = s
+	err = saveSessionsLocked()
 	sessionsMu.Unlock()
-	http.SetCookie(w, &http.Cookie{
+	if err != nil {
+		return "", err
+	}
+	c := &http.Cookie{
 		Name:     cookieName,
-		Value:    id,
+		Value:    id + "." + signSessionID(secret, id),
 		Path:     "/",
-		MaxAge:   cookieMaxAge,
 		HttpOnly: true,
+		Secure:   r.TLS != nil, // 通过 HTTPS 访问时 Cookie 不会再经由明文 HTTP 发送
 		SameSite: http.SameSiteLaxMode,
-	})
-	return id, nil
+	}
+	if s.Remember && !s.Pending {
+		c.MaxAge = int(RememberTTL / time.Second)
+	}
+	http.SetCookie(w, c)
+	return key, nil
 }
 
-func getSession(r *http.Request) (string, bool) {
-	c, err := r.Cookie(cookieName)
-	if err != nil || c.Value == "" {
-		return "", false
+// getSession 按 Cookie 查找有效会话，并记录最近访问时间（由 sweeper 定期保存）
+func getSession(r *http.Request) (session, bool) {
+	key, ok := cookieSessionKey(r)
+	if !ok {
+		return session{}, false
 	}
-	sessionsMu.RLock()
-	exp, ok := sessions[c.Value]
-	sessionsMu.RUnlock()
-	if !ok || time.Now().After(exp) {
-		return "", false
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	loadSessionsLocked()
+	s, ok := sessions[key]
+	now := time.Now()
+	if !ok || !s.valid(now) {
+		return session{}, false
+	}
+	if ip := clientIP(r); now.Sub(s.LastSeen) >= touchInterval || ip != s.IP {
+		s.LastSeen, s.IP = now, ip
+		sessions[key] = s
+		sessionsDirty = true
+	}
+	return s, true
+}
+
+// pendingSession 返回等待两步验证的会话及其键
+func pendingSession(r *http.Request) (string, session, bool) {
+	key, ok := cookieSessionKey(r)
+	if !ok {
+		return "", session{}, false
+	}
+	s, ok := getSession(r)
+	if !ok || !s.Pending {
+		return "", session{}, false
+	}
+	return key, s, true
+}
+
+// failPending 记录一次验证码错误，返回是否已超过次数（超过后删除该临时会话）
+func failPending(key string) bool {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	loadSessionsLocked()
+	s, ok := sessions[key]
+	if !ok {
+		return true
+	}
+	s.Attempts++
+	if s.Attempts >= maxPendingAttempts {
+		delete(sessions, key)
+		_ = saveSessionsLocked()
+		return true
+	}
+	sessions[key] = s
+	_ = saveSessionsLocked()
+	return false
+}
+
+// deleteSession 删除指定会话（两步验证通过后换发新的会话 ID）
+func deleteSession(key string) {
+	sessionsMu.Lock()
+	loadSessionsLocked()
+	delete(sessions, key)
+	_ = saveSessionsLocked()
+	sessionsMu.Unlock()
+}
+
+// destroyUserSessions 注销某个用户除 except 以外的全部会话（用户被删除、修改密码或「在所有设备上退出」时），返回注销的数量
+func destroyUserSessions(user, except string) int {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	loadSessionsLocked()
+	n := 0
+	for key, s := range sessions {
+		if key != except && strings.EqualFold(s.User, user) {
+			delete(sessions, key)
+			n++
+		}
+	}
+	if n > 0 {
+		_ = saveSessionsLocked()
 	}
-	return c.Value, true
+	return n
+}
+
+// listSessions 返回 user 的有效会话（user 为空时返回全部用户的），不含等待两步验证的临时会话
+func listSessions(user string) map[string]session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	loadSessionsLocked()
+	now := time.Now()
+	out := make(map[string]session)
+	for key, s := range sessions {
+		if !s.Pending && s.valid(now) && (user == "" || strings.EqualFold(s.User, user)) {
+			out[key] = s
+		}
+	}
+	return out
 }
 
 func destroySession(w http.ResponseWriter, r *http.Request) {
-	c, err := r.Cookie(cookieName)
-	if err == nil && c.Value != "" {
-		sessionsMu.Lock()
-		delete(sessions, c.Value)
-		sessionsMu.Unlock()
+	if key, ok := cookieSessionKey(r); ok {
+		deleteSession(key)
 	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     cookieName,
@@ -73,6 +353,38 @@ func destroySession(w http.ResponseWriter, r *http.Request) {
 		Path:     "/",
 		MaxAge:   -1,
 		HttpOnly: true,
+		Secure:   r.TLS != nil,
 		SameSite: http.SameSiteLaxMode,
 	})
 }
+
+// sweepSessions 删除已过期的会话，并保存尚未写入的最近访问时间
+func sweepSessions() {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	loadSessionsLocked()
+	now := time.Now()
+	changed := sessionsDirty
+	for key, s := range sessions {
+		if !s.valid(now) {
+			delete(sessions, key)
+			changed = true
+		}
+	}
+	if changed {
+		_ = saveSessionsLocked()
+	}
+}
+
+// StartSessionSweeper 在后台每隔 interval 清理过期会话
+func StartSessionSweeper(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			sweepSessions()
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"lwshell/internal/audit"
+)
+
+// SessionResp 一个登录会话；ID 为服务端保存会话时使用的键（不是 Cookie，不能用于登录），仅用于撤销
+type SessionResp struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+	Expires   time.Time `json:"expires"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Remember  bool      `json:"remember"`
+	Current   bool      `json:"current"` // 是否为发起本次请求的会话
+}
+
+// SessionsAPI 登录会话管理（路由需用 RequireAuth 包装）：
+// GET /api/auth/sessions 列出当前用户的会话，管理员加 ?all=1 列出全部用户的；
+// DELETE /api/auth/sessions/:id 撤销一个会话（管理员可撤销任意用户的会话）；
+// DELETE /api/auth/sessions 在所有设备上退出（含当前会话），加 ?others=1 时保留当前会话
+func SessionsAPI(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/auth/sessions"), "/")
+	current, _ := cookieSessionKey(r)
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		user := u.Name
+		if r.URL.Query().Get("all") == "1" && u.Role == RoleAdmin {
+			user = ""
+		}
+		out := make([]SessionResp, 0)
+		for key, s := range listSessions(user) {
+			out = append(out, SessionResp{
+				ID: key, User: s.User, Created: s.Created, LastSeen: s.LastSeen, Expires: s.Expires,
+				IP: s.IP, UserAgent: s.UserAgent, Remember: s.Remember, Current: key == current,
+			})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"sessions": out})
+	case id == "" && r.Method == http.MethodDelete:
+		except := ""
+		if r.URL.Query().Get("others") == "1" {
+			except = current
+		}
+		n := destroyUserSessions(u.Name, except)
+		audit.LogAuth("logout_all", u.Name, clientIP(r), "ok", fmt.Sprintf("revoked=%d", n))
+		if except == "" {
+			destroySession(w, r)
+		}
+		writeOK(w)
+	case id != "" && r.Method == http.MethodDelete:
+		s, ok := listSessions("")[id]
+		// 普通用户只能撤销自己的会话，撤销他人的会话按不存在处理
+		if !ok || (!strings.EqualFold(s.User, u.Name) && u.Role != RoleAdmin) {
+			http.Error(w, "会话不存在或已过期", http.StatusNotFound)
+			return
+		}
+		deleteSession(id)
+		audit.LogAuth("session_revoke", u.Name, clientIP(r), "ok", "target="+s.User+" ip="+s.IP)
+		if id == current {
+			destroySession(w, r)
+		}
+		writeOK(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
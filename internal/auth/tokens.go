@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lwshell/internal/audit"
+	"lwshell/internal/config"
+)
+
+// 个人 API 令牌：供脚本与 CI 以 Authorization: Bearer <令牌> 调用接口，代表创建者本人，权限再按 Scope 收窄。
+// 令牌只在创建时显示一次，tokens.json 中只保存其 SHA-256
+const (
+	ScopeRead    = "read"    // 只读：只能调用 GET 接口，不能连接、修改或导出
+	ScopeConnect = "connect" // 只读 + 发起连接
+	ScopeAdmin   = "admin"   // 与创建者相同的全部权限
+
+	tokenPrefix = "lws_"
+)
+
+// APIToken 一个 API 令牌；Hash 为令牌的 SHA-256，Hint 为令牌末尾几位，便于在列表中辨认
+type APIToken struct {
+	ID       string     `json:"id"`
+	User     string     `json:"user"`
+	Name     string     `json:"name"`
+	Scope    string     `json:"scope"`
+	Hash     string     `json:"hash"`
+	Hint     string     `json:"hint"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"` // 为空表示不过期
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+var (
+	errTokenNotFound = errors.New("令牌不存在")
+	errInvalidScope  = errors.New("权限范围须为 read、connect 或 admin")
+	tokensMu         sync.Mutex
+)
+
+// scopeAllows 判断令牌的权限范围是否包含 p（在用户本身权限的基础上再收窄）
+func scopeAllows(scope string, p Perm) bool {
+	switch scope {
+	case ScopeAdmin:
+		return true
+	case ScopeConnect:
+		return p == PermConnect
+	}
+	return false
+}
+
+func tokensPath() (string, error) {
+	dir, err := authDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tokens.json"), nil
+}
+
+type tokensFile struct {
+	Tokens []APIToken `json:"tokens"`
+}
+
+func loadTokens() ([]APIToken, error) {
+	p, err := tokensPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f tokensFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return f.Tokens, nil
+}
+
+// updateTokens 在锁内读取、修改并保存（先写临时文件再重命名）
+func updateTokens(fn func(tokens []APIToken) ([]APIToken, error)) error {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	tokens, err := loadTokens()
+	if err != nil {
+		return err
+	}
+	if tokens, err = fn(tokens); err != nil {
+		return err
+	}
+	p, err := tokensPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tokensFile{Tokens: tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(p, data, 0600)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createToken 生成令牌并保存其哈希，返回明文令牌（只此一次）
+func createToken(user, name, scope string, ttl time.Duration) (string, APIToken, error) {
+	if scope != ScopeRead && scope != ScopeConnect && scope != ScopeAdmin {
+		return "", APIToken{}, errInvalidScope
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIToken{}, err
+	}
+	plain := tokenPrefix + b64url.EncodeToString(b)
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", APIToken{}, err
+	}
+	if name == "" {
+		name = "API 令牌"
+	}
+	t := APIToken{
+		ID: hex.EncodeToString(id), User: user, Name: name, Scope: scope,
+		Hash: hashToken(plain), Hint: plain[len(plain)-4:], Created: time.Now().UTC(),
+	}
+	if ttl > 0 {
+		exp := t.Created.Add(ttl)
+		t.Expires = &exp
+	}
+	err := updateTokens(func(tokens []APIToken) ([]APIToken, error) {
+		return append(tokens, t), nil
+	})
+	return plain, t, err
+}
+
+// tokenUser 按 Authorization: Bearer 查找令牌与其所属用户；令牌无效、已过期或用户已删除时返回 nil。
+// 返回的用户带有令牌的权限范围，Can / CanAny 会据此收窄
+func tokenUser(r *http.Request) (*User, *APIToken) {
+	plain, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+	h := hashToken(plain)
+	now := time.Now().UTC()
+	tokensMu.Lock()
+	tokens, err := loadTokens()
+	tokensMu.Unlock()
+	if err != nil {
+		return nil, nil
+	}
+	var found *APIToken
+	for i := range tokens {
+		if t := &tokens[i]; t.Hash == h && (t.Expires == nil || now.Before(*t.Expires)) {
+			found = t
+			break
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	// 最近使用时间按分钟记录，避免每个请求都写文件
+	if found.LastUsed == nil || now.Sub(*found.LastUsed) >= time.Minute {
+		_ = updateTokens(func(tokens []APIToken) ([]APIToken, error) {
+			for i := range tokens {
+				if tokens[i].ID == found.ID {
+					tokens[i].LastUsed = &now
+				}
+			}
+			return tokens, nil
+		})
+	}
+	u, err := FindUser(found.User)
+	if err != nil || u == nil {
+		return nil, nil
+	}
+	u.scope = found.Scope
+	return u, found
+}
+
+// bearerToken 取出 Authorization: Bearer 中的令牌
+func bearerToken(r *http.Request) (string, bool) {
+	v := r.Header.Get("Authorization")
+	if len(v) < 7 || !strings.EqualFold(v[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(v[7:]), true
+}
+
+// deleteUserTokens 删除某个用户的全部令牌（用户被删除时）
+func deleteUserTokens(name string) error {
+	return updateTokens(func(tokens []APIToken) ([]APIToken, error) {
+		out := tokens[:0]
+		for _, t := range tokens {
+			if !strings.EqualFold(t.User, name) {
+				out = append(out, t)
+			}
+		}
+		return out, nil
+	})
+}
+
+// TokenReq 创建令牌；ExpiresDays 为 0 表示不过期
+type TokenReq struct {
+	Name        string `json:"name"`
+	Scope       string `json:"scope"`
+	ExpiresDays int    `json:"expires_days"`
+}
+
+// TokenResp 令牌信息（不含哈希）；Token 仅在创建时返回一次
+type TokenResp struct {
+	ID       string     `json:"id"`
+	User     string     `json:"user"`
+	Name     string     `json:"name"`
+	Scope    string     `json:"scope"`
+	Hint     string     `json:"hint"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	Token    string     `json:"token,omitempty"`
+}
+
+func tokenResp(t APIToken) TokenResp {
+	return TokenResp{ID: t.ID, User: t.User, Name: t.Name, Scope: t.Scope, Hint: t.Hint, Created: t.Created, Expires: t.Expires, LastUsed: t.LastUsed}
+}
+
+// TokensAPI 当前用户的 API 令牌（路由需用 RequireAuth 包装，只能在浏览器登录后管理，不能用令牌本身调用）：
+// GET /api/tokens 列出，管理员加 ?all=1 列出全部用户的；POST /api/tokens 创建并返回明文令牌；
+// DELETE /api/tokens/:id 撤销（管理员可撤销任意用户的令牌）
+func TokensAPI(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tokens"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		all := r.URL.Query().Get("all") == "1" && u.Role == RoleAdmin
+		tokensMu.Lock()
+		tokens, err := loadTokens()
+		tokensMu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out := make([]TokenResp, 0)
+		for _, t := range tokens {
+			if all || strings.EqualFold(t.User, u.Name) {
+				out = append(out, tokenResp(t))
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tokens": out})
+	case id == "" && r.Method == http.MethodPost:
+		var req TokenReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresDays < 0 {
+			http.Error(w, "有效期不能为负数", http.StatusBadRequest)
+			return
+		}
+		plain, t, err := createToken(u.Name, strings.TrimSpace(req.Name), req.Scope, time.Duration(req.ExpiresDays)*24*time.Hour)
+		if err != nil {
+			writeTokenError(w, err)
+			return
+		}
+		audit.LogAuth("token_create", u.Name, clientIP(r), "ok", fmt.Sprintf("id=%s scope=%s", t.ID, t.Scope))
+		resp := tokenResp(t)
+		resp.Token = plain
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	case id != "" && r.Method == http.MethodDelete:
+		var owner string
+		err := updateTokens(func(tokens []APIToken) ([]APIToken, error) {
+			for i, t := range tokens {
+				// 普通用户只能撤销自己的令牌，撤销他人的令牌按不存在处理
+				if t.ID == id && (strings.EqualFold(t.User, u.Name) || u.Role == RoleAdmin) {
+					owner = t.User
+					return append(tokens[:i], tokens[i+1:]...), nil
+				}
+			}
+			return nil, errTokenNotFound
+		})
+		if err != nil {
+			writeTokenError(w, err)
+			return
+		}
+		audit.LogAuth("token_revoke", u.Name, clientIP(r), "ok", "id="+id+" target="+owner)
+		writeOK(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeTokenError 不存在 404，参数错误 400
+func writeTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTokenNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errInvalidScope):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
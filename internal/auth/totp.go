@@ -0,0 +1,396 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"lwshell/internal/audit"
+)
+
+// 两步验证：RFC 6238 TOTP（HMAC-SHA1、6 位、30 秒），兼容 Google Authenticator、1Password 等应用
+const (
+	totpIssuer    = "lwshell"
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSkew      = 1 // 允许前后各一个时间步的时钟偏差
+	recoveryCount = 10
+	recoveryLen   = 10 // 恢复码的十六进制位数（不含中间的短横线）
+)
+
+var (
+	ErrTOTPInvalid    = errors.New("验证码错误")
+	ErrTOTPNotPending = errors.New("请先生成二维码")
+	ErrTOTPNotEnabled = errors.New("未启用两步验证")
+	ErrTOTPEnabled    = errors.New("已启用两步验证，请先用当前密码关闭后再重新设置")
+	totpEncoding      = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// totpCode 计算第 step 个时间步的验证码
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// matchTOTP 在允许的时钟偏差内查找与 code 匹配的时间步，且必须晚于 lastStep（防止重放）；未匹配返回 0
+func matchTOTP(secret, code string, lastStep int64, now time.Time) int64 {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if step > lastStep && subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpURI 认证器应用扫描的 otpauth:// 地址
+func totpURI(user, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("period", fmt.Sprint(totpPeriod))
+	v.Set("digits", fmt.Sprint(totpDigits))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+user) + "?" + v.Encode()
+}
+
+// newRecoveryCodes 生成一次性恢复码，返回明文（只展示一次）与保存用的哈希
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCount; i++ {
+		b := make([]byte, recoveryLen/2)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		c := hex.EncodeToString(b)
+		c = c[:len(c)/2] + "-" + c[len(c)/2:]
+		codes = append(codes, c)
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 恢复码为随机值，SHA-256 即可；忽略大小写、空白与短横线
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// startTOTP 为用户生成新的待确认密钥（未确认前不影响登录）；已启用时返回 ErrTOTPEnabled，
+// 否则仅凭会话即可换掉密钥、作废恢复码，绕过关闭时的密码确认
+func startTOTP(name string) (string, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	err = updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		if users[i].TOTPSecret != "" {
+			return nil, ErrTOTPEnabled
+		}
+		users[i].TOTPPending = secret
+		return users, nil
+	})
+	return secret, err
+}
+
+// enableTOTP 用验证码确认待确认的密钥并启用两步验证，返回新的恢复码
+func enableTOTP(name, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		u := &users[i]
+		if u.TOTPSecret != "" {
+			return nil, ErrTOTPEnabled
+		}
+		if u.TOTPPending == "" {
+			return nil, ErrTOTPNotPending
+		}
+		step := matchTOTP(u.TOTPPending, code, 0, time.Now())
+		if step == 0 {
+			return nil, ErrTOTPInvalid
+		}
+		u.TOTPSecret, u.TOTPPending, u.TOTPLastStep, u.Recovery = u.TOTPPending, "", step, hashes
+		return users, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP 关闭用户的两步验证并清除恢复码（本人关闭或管理员为丢失手机的用户重置）
+func DisableTOTP(name string) error {
+	return updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		u := &users[i]
+		u.TOTPSecret, u.TOTPPending, u.TOTPLastStep, u.Recovery = "", "", 0, nil
+		return users, nil
+	})
+}
+
+// regenerateRecovery 重新生成恢复码，旧的全部作废
+func regenerateRecovery(name string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		if users[i].TOTPSecret == "" {
+			return nil, ErrTOTPNotEnabled
+		}
+		users[i].Recovery = hashes
+		return users, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor 校验验证码或恢复码；成功时记录时间步或作废该恢复码。recovery 表示使用了恢复码
+func verifySecondFactor(name, code string) (ok, recovery bool, err error) {
+	code = strings.TrimSpace(code)
+	err = updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		u := &users[i]
+		if u.TOTPSecret == "" {
+			return nil, ErrTOTPNotEnabled
+		}
+		if step := matchTOTP(u.TOTPSecret, code, u.TOTPLastStep, time.Now()); step > 0 {
+			u.TOTPLastStep, ok = step, true
+			return users, nil
+		}
+		h := hashRecoveryCode(code)
+		for j, v := range u.Recovery {
+			if subtle.ConstantTimeCompare([]byte(v), []byte(h)) == 1 {
+				u.Recovery = append(u.Recovery[:j], u.Recovery[j+1:]...)
+				ok, recovery = true, true
+				return users, nil
+			}
+		}
+		return nil, ErrTOTPInvalid
+	})
+	if errors.Is(err, ErrTOTPInvalid) {
+		return false, false, nil
+	}
+	return ok, recovery, err
+}
+
+// TOTPVerifyReq 登录第二步：6 位验证码或恢复码
+type TOTPVerifyReq struct {
+	Code string `json:"code"`
+}
+
+// TOTPVerify 登录第二步（无需已登录，但须持有 Login 下发的临时会话）：验证通过后换发正式会话；
+// 连续输错 5 次或超过 5 分钟需重新输入密码
+func TOTPVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, s, ok := pendingSession(r)
+	if !ok {
+		http.Error(w, "请重新输入密码", http.StatusUnauthorized)
+		return
+	}
+	var req TOTPVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if checkLocked(w, r, "login_totp", s.User) {
+		return
+	}
+	ok, recovery, err := verifySecondFactor(s.User, req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		failAttempt(r, "login_totp", s.User)
+		if failPending(id) {
+			http.Error(w, "验证码错误次数过多，请重新输入密码", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, ErrTOTPInvalid.Error(), http.StatusForbidden)
+		return
+	}
+	detail := ""
+	if recovery {
+		detail = "method=recovery"
+	}
+	audit.LogAuth("login_totp", s.User, clientIP(r), "success", detail)
+	recordSuccess(clientIP(r))
+	deleteSession(id)
+	if _, err := createSession(w, r, s.User, s.Remember); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeOK(w)
+}
+
+// TOTPStatusResp 当前用户的两步验证状态
+type TOTPStatusResp struct {
+	Enabled  bool `json:"enabled"`
+	Recovery int  `json:"recovery"` // 剩余恢复码数量
+}
+
+// TOTPSetupResp 扫码绑定：Secret 供无法扫码时手动输入，QR 为 PNG 的 data URL
+type TOTPSetupResp struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QR     string `json:"qr"`
+}
+
+// TOTPBody 启用时填写验证码；关闭或重新生成恢复码时填写当前密码
+type TOTPBody struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+// TOTPAPI 当前用户的两步验证设置（路由需用 RequireAuth 包装）：
+// GET /api/auth/totp 状态；POST /api/auth/totp/setup 生成密钥与二维码；POST /api/auth/totp/enable 用验证码确认并返回恢复码；
+// POST /api/auth/totp/disable 关闭；POST /api/auth/totp/recovery 重新生成恢复码（后两者需当前密码）；
+// 已启用时 setup / enable 返回 409，须先凭密码关闭才能更换密钥
+func TOTPAPI(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/auth/totp"), "/")
+	u := CurrentUser(r)
+	if action == "" && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(TOTPStatusResp{Enabled: u.TOTPSecret != "", Recovery: len(u.Recovery)})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body TOTPBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	switch action {
+	case "setup":
+		secret, err := startTOTP(u.Name)
+		if err != nil {
+			writeTOTPError(w, err)
+			return
+		}
+		uri := totpURI(u.Name, secret)
+		png, err := qrcode.Encode(uri, qrcode.Medium, 240)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(TOTPSetupResp{Secret: secret, URI: uri, QR: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)})
+	case "enable":
+		codes, err := enableTOTP(u.Name, strings.TrimSpace(body.Code))
+		if err != nil {
+			writeTOTPError(w, err)
+			return
+		}
+		audit.LogAuth("totp_enable", u.Name, clientIP(r), "ok", "")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+	case "disable", "recovery":
+		if checkLocked(w, r, "totp_"+action, u.Name) {
+			return
+		}
+		ok, err := VerifyUser(u.Name, strings.TrimSpace(body.Password))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ok == nil {
+			failAttempt(r, "totp_"+action, u.Name)
+			http.Error(w, "当前密码错误", http.StatusForbidden)
+			return
+		}
+		if action == "disable" {
+			if err := DisableTOTP(u.Name); err != nil {
+				writeTOTPError(w, err)
+				return
+			}
+			audit.LogAuth("totp_disable", u.Name, clientIP(r), "ok", "")
+			writeOK(w)
+			return
+		}
+		codes, err := regenerateRecovery(u.Name)
+		if err != nil {
+			writeTOTPError(w, err)
+			return
+		}
+		audit.LogAuth("totp_recovery", u.Name, clientIP(r), "ok", "")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// writeTOTPError 验证码错误或尚未生成密钥 400，已启用时再次设置 409，用户不存在 404
+func writeTOTPError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrTOTPEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrTOTPInvalid), errors.Is(err, ErrTOTPNotPending), errors.Is(err, ErrTOTPNotEnabled):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
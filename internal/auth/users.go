@@ -0,0 +1,413 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"lwshell/internal/config"
+)
+
+// 角色：admin 拥有全部权限（含用户管理、导入、快照与模板）；operator 默认可连接、编辑与导出所有分组；
+// viewer 默认只能查看。为 operator / viewer 设置分组授权（Grants）后，只在授权的分组内拥有授权的权限
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// Perm 权限
+type Perm string
+
+const (
+	PermConnect Perm = "connect"
+	PermEdit    Perm = "edit"
+	PermExport  Perm = "export"
+	PermAdmin   Perm = "admin" // 用户管理、导入、快照、模板等全局操作，仅 admin 角色拥有
+)
+
+// DefaultUser 由旧版主密码迁移而来的管理员用户名，登录时未填用户名即为该用户
+const DefaultUser = "admin"
+
+// Grant 分组授权：Group 为分组路径，同时作用于其子目录
+type Grant struct {
+	Group string `json:"group"`
+	Perms []Perm `json:"perms"`
+}
+
+// User 一个 Web 登录用户，密码只保存 bcrypt 哈希；启用两步验证后 TOTPSecret 非空（见 totp.go）
+type User struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Role    string    `json:"role"`
+	Grants  []Grant   `json:"grants,omitempty"`
+	Created time.Time `json:"created"`
+
+	TOTPSecret   string   `json:"totp_secret,omitempty"`    // 已启用的 TOTP 密钥（base32）
+	TOTPPending  string   `json:"totp_pending,omitempty"`   // 扫码后尚未用验证码确认的密钥
+	TOTPLastStep int64    `json:"totp_last_step,omitempty"` // 最近一次使用的时间步，同一验证码不能重复使用
+	Recovery     []string `json:"recovery,omitempty"`       // 恢复码的 SHA-256，每个只能使用一次
+
+	scope string // 通过 API 令牌访问时为令牌的权限范围（见 tokens.go），为空表示浏览器会话
+}
+
+var (
+	ErrUserExists    = errors.New("用户已存在")
+	ErrUserNotFound  = errors.New("用户不存在")
+	ErrInvalidName   = errors.New("用户名只能包含字母、数字、点、下划线和短横线（1-32 位）")
+	ErrInvalidRole   = errors.New("角色须为 admin、operator 或 viewer")
+	ErrLastAdmin     = errors.New("至少需要保留一个管理员")
+	errInvalidPerm   = errors.New("权限须为 connect、edit 或 export")
+	userNamePattern  = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+	usersMu          sync.Mutex
+	rolePermDefaults = map[string][]Perm{
+		RoleOperator: {PermConnect, PermEdit, PermExport},
+		RoleViewer:   nil,
+	}
+)
+
+// Can 判断用户是否可以对 group 分组中的服务器执行 p
+func (u *User) Can(p Perm, group string) bool {
+	if u.scope != "" && !scopeAllows(u.scope, p) {
+		return false
+	}
+	if u.Role == RoleAdmin {
+		return true
+	}
+	if p == PermAdmin {
+		return false
+	}
+	if len(u.Grants) == 0 {
+		return hasPerm(rolePermDefaults[u.Role], p)
+	}
+	for _, g := range u.Grants {
+		if inGroup(group, g.Group) && hasPerm(g.Perms, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAny 判断用户是否在任一分组中拥有 p（用于中间件的粗粒度检查，具体分组由 handler 再用 Can 判断）
+func (u *User) CanAny(p Perm) bool {
+	if u.scope != "" && !scopeAllows(u.scope, p) {
+		return false
+	}
+	if u.Role == RoleAdmin {
+		return true
+	}
+	if p == PermAdmin {
+		return false
+	}
+	if len(u.Grants) == 0 {
+		return hasPerm(rolePermDefaults[u.Role], p)
+	}
+	for _, g := range u.Grants {
+		if hasPerm(g.Perms, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermMap 返回用户的有效权限：键为分组路径，"*" 表示全部分组（供前端决定显示哪些按钮）
+func (u *User) PermMap() map[string][]Perm {
+	if u.Role == RoleAdmin {
+		return map[string][]Perm{"*": {PermConnect, PermEdit, PermExport, PermAdmin}}
+	}
+	if len(u.Grants) == 0 {
+		return map[string][]Perm{"*": append([]Perm{}, rolePermDefaults[u.Role]...)}
+	}
+	out := make(map[string][]Perm, len(u.Grants))
+	for _, g := range u.Grants {
+		out[g.Group] = append(out[g.Group], g.Perms...)
+	}
+	return out
+}
+
+func hasPerm(perms []Perm, p Perm) bool {
+	for _, v := range perms {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// inGroup 判断分组 group 是否为 parent 或其子目录
+func inGroup(group, parent string) bool {
+	return group == parent || strings.HasPrefix(group, parent+"/")
+}
+
+func usersPath() (string, error) {
+	dir, err := authDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "users.json"), nil
+}
+
+type usersFile struct {
+	Users []User `json:"users"`
+}
+
+// loadUsers 读取 users.json；不存在而旧版 .auth_hash 存在时，将主密码迁移为 admin 用户（原文件保留）
+func loadUsers() ([]User, error) {
+	p, err := usersPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return migrateMasterPassword()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f usersFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return f.Users, nil
+}
+
+func migrateMasterPassword() ([]User, error) {
+	hp, err := hashPath()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := os.ReadFile(hp)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	users := []User{{Name: DefaultUser, Hash: strings.TrimSpace(string(hash)), Role: RoleAdmin, Created: time.Now().UTC()}}
+	if err := saveUsers(users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// saveUsers 先写临时文件再重命名，避免写到一半时丢失全部账号
+func saveUsers(users []User) error {
+	p, err := usersPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(usersFile{Users: users}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(p, data, 0600)
+}
+
+// updateUsers 在锁内读取、修改并保存用户列表
+func updateUsers(fn func(users []User) ([]User, error)) error {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	users, err := loadUsers()
+	if err != nil {
+		return err
+	}
+	users, err = fn(users)
+	if err != nil {
+		return err
+	}
+	return saveUsers(users)
+}
+
+// FindUser 按用户名查找（不区分大小写），不存在时返回 nil
+func FindUser(name string) (*User, error) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	users, err := loadUsers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if strings.EqualFold(users[i].Name, name) {
+			return &users[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func findIndex(users []User, name string) int {
+	for i := range users {
+		if strings.EqualFold(users[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < 6 {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	return string(hash), err
+}
+
+// dummyHash 用户不存在时同样做一次 bcrypt 比较，避免通过响应时间判断用户名是否存在
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("lwshell-dummy"), bcrypt.MinCost)
+
+// VerifyUser 校验用户名与密码，成功时返回该用户
+func VerifyUser(name, password string) (*User, error) {
+	u, err := FindUser(name)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Hash), []byte(password)) != nil {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// CreateUser 新增用户
+func CreateUser(name, password, role string, grants []Grant) error {
+	if !userNamePattern.MatchString(name) {
+		return ErrInvalidName
+	}
+	if err := validateRole(role, grants); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return updateUsers(func(users []User) ([]User, error) {
+		if findIndex(users, name) >= 0 {
+			return nil, ErrUserExists
+		}
+		return append(users, User{Name: name, Hash: hash, Role: role, Grants: grants, Created: time.Now().UTC()}), nil
+	})
+}
+
+// SetUserPassword 修改用户密码
+func SetUserPassword(name, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		users[i].Hash = hash
+		return users, nil
+	})
+}
+
+// SetUserRole 修改用户角色与分组授权；不能把最后一个管理员降级
+func SetUserRole(name, role string, grants []Grant) error {
+	if err := validateRole(role, grants); err != nil {
+		return err
+	}
+	return updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		if users[i].Role == RoleAdmin && role != RoleAdmin && countAdmins(users) == 1 {
+			return nil, ErrLastAdmin
+		}
+		users[i].Role = role
+		users[i].Grants = grants
+		return users, nil
+	})
+}
+
+// RenameGrants 分组路径 from 重命名（或移动）为 to 时，同步改写各用户对 from 及其子目录的授权，返回改写的授权数；
+// 否则用户会失去对改名后分组的权限，而之后新建的同名分组却继承旧授权
+func RenameGrants(from, to string) (int, error) {
+	changed := 0
+	err := updateUsers(func(users []User) ([]User, error) {
+		for i := range users {
+			for j := range users[i].Grants {
+				g := &users[i].Grants[j]
+				if inGroup(g.Group, from) {
+					g.Group = normalizeGroup(to + strings.TrimPrefix(g.Group, from))
+					changed++
+				}
+			}
+		}
+		return users, nil
+	})
+	return changed, err
+}
+
+// DeleteUser 删除用户；不能删除最后一个管理员
+func DeleteUser(name string) error {
+	return updateUsers(func(users []User) ([]User, error) {
+		i := findIndex(users, name)
+		if i < 0 {
+			return nil, ErrUserNotFound
+		}
+		if users[i].Role == RoleAdmin && countAdmins(users) == 1 {
+			return nil, ErrLastAdmin
+		}
+		return append(users[:i], users[i+1:]...), nil
+	})
+}
+
+// ListUsers 返回所有用户（含哈希，调用方负责不对外输出）
+func ListUsers() ([]User, error) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	return loadUsers()
+}
+
+func countAdmins(users []User) int {
+	n := 0
+	for _, u := range users {
+		if u.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// validateRole 校验角色与授权，并规范授权中的分组路径
+func validateRole(role string, grants []Grant) error {
+	if role != RoleAdmin && role != RoleOperator && role != RoleViewer {
+		return ErrInvalidRole
+	}
+	for i := range grants {
+		grants[i].Group = normalizeGroup(grants[i].Group)
+		for _, p := range grants[i].Perms {
+			if p != PermConnect && p != PermEdit && p != PermExport {
+				return errInvalidPerm
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeGroup 与服务器分组相同的规范化：去掉每级首尾空白与空的层级
+func normalizeGroup(g string) string {
+	var parts []string
+	for _, p := range strings.Split(g, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"lwshell/internal/audit"
+)
+
+// UserResp 对外暴露的用户信息（不含密码哈希）
+type UserResp struct {
+	Name    string    `json:"name"`
+	Role    string    `json:"role"`
+	Grants  []Grant   `json:"grants,omitempty"`
+	Created time.Time `json:"created"`
+	TOTP    bool      `json:"totp"` // 是否已启用两步验证
+}
+
+// UserBody 创建 / 修改用户的请求体；修改时 Password 为空表示不修改密码，Role 为空表示不修改角色与授权，
+// ResetTOTP 为 true 时关闭该用户的两步验证（用户丢失手机且恢复码用完时由管理员重置）
+type UserBody struct {
+	Name      string  `json:"name"`
+	Password  string  `json:"password"`
+	Role      string  `json:"role"`
+	Grants    []Grant `json:"grants"`
+	ResetTOTP bool    `json:"reset_totp"`
+}
+
+// UsersAPI 用户管理（仅管理员，路由需用 Require(PermAdmin, ...) 包装）：
+// GET /api/users 列出用户；POST /api/users 创建；PUT /api/users/:name 修改密码、角色或分组授权；DELETE /api/users/:name 删除
+func UsersAPI(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/users"), "/")
+	actor := Actor(r)
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		users, err := ListUsers()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out := make([]UserResp, 0, len(users))
+		for _, u := range users {
+			out = append(out, UserResp{Name: u.Name, Role: u.Role, Grants: u.Grants, Created: u.Created, TOTP: u.TOTPSecret != ""})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"users": out})
+	case name == "" && r.Method == http.MethodPost:
+		var body UserBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		body.Name = strings.TrimSpace(body.Name)
+		if err := CreateUser(body.Name, strings.TrimSpace(body.Password), body.Role, body.Grants); err != nil {
+			writeUserError(w, err)
+			return
+		}
+		audit.LogAuth("user_create", actor, clientIP(r), "ok", "target="+body.Name+" role="+body.Role)
+		writeOK(w)
+	case name != "" && r.Method == http.MethodPut:
+		var body UserBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if pwd := strings.TrimSpace(body.Password); pwd != "" {
+			if err := SetUserPassword(name, pwd); err != nil {
+				writeUserError(w, err)
+				return
+			}
+			// 管理员修改密码后该用户在其他设备上的会话全部失效（修改自己的密码时保留当前会话）
+			current, _ := cookieSessionKey(r)
+			n := destroyUserSessions(name, current)
+			audit.LogAuth("user_password", actor, clientIP(r), "ok", fmt.Sprintf("target=%s revoked=%d", name, n))
+		}
+		if body.Role != "" {
+			if err := SetUserRole(name, body.Role, body.Grants); err != nil {
+				writeUserError(w, err)
+				return
+			}
+			audit.LogAuth("user_role", actor, clientIP(r), "ok", fmt.Sprintf("target=%s role=%s grants=%d", name, body.Role, len(body.Grants)))
+		}
+		if body.ResetTOTP {
+			if err := DisableTOTP(name); err != nil {
+				writeUserError(w, err)
+				return
+			}
+			audit.LogAuth("totp_disable", actor, clientIP(r), "ok", "target="+name)
+		}
+		writeOK(w)
+	case name != "" && r.Method == http.MethodDelete:
+		if strings.EqualFold(name, actor) {
+			http.Error(w, "不能删除当前登录的用户", http.StatusBadRequest)
+			return
+		}
+		if err := DeleteUser(name); err != nil {
+			writeUserError(w, err)
+			return
+		}
+		destroyUserSessions(name, "")
+		if err := deleteUserPasskeys(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := deleteUserTokens(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit.LogAuth("user_delete", actor, clientIP(r), "ok", "target="+name)
+		writeOK(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// writeUserError 用户不存在 404，已存在 409，参数错误 400
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrPasswordTooShort), errors.Is(err, ErrInvalidName), errors.Is(err, ErrInvalidRole),
+		errors.Is(err, ErrLastAdmin), errors.Is(err, errInvalidPerm):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
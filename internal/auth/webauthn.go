@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// WebAuthn（通行密钥）协议的最小实现：注册时只接受 attestation "none"（不校验认证器型号），
+// 支持 ES256、EdDSA 与 RS256 三种签名算法；HTTP 接口与存储见 passkeys.go
+
+// COSE 算法编号
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+// authenticatorData 的标志位
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var (
+	errCBOR        = errors.New("invalid CBOR")
+	errAuthData    = errors.New("invalid authenticator data")
+	errUnsupported = errors.New("unsupported credential public key")
+	b64url         = base64.RawURLEncoding
+)
+
+// clientData 浏览器生成并由认证器签名的 clientDataJSON
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// parseClientData 校验类型（webauthn.create / webauthn.get）与来源，返回其中的 challenge（base64url）
+func parseClientData(raw []byte, typ, origin string) (string, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return "", fmt.Errorf("invalid clientDataJSON: %w", err)
+	}
+	if cd.Type != typ {
+		return "", fmt.Errorf("clientData type %q, want %q", cd.Type, typ)
+	}
+	if cd.Origin != origin {
+		return "", fmt.Errorf("clientData origin %q, want %q", cd.Origin, origin)
+	}
+	if cd.Challenge == "" {
+		return "", errors.New("clientData missing challenge")
+	}
+	return cd.Challenge, nil
+}
+
+// authData 解析后的 authenticatorData；CredID / PublicKey 仅在注册时（AT 标志）存在
+type authData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	CredID    []byte
+	PublicKey crypto.PublicKey
+	Alg       int
+}
+
+// parseAuthData 解析 authenticatorData 并校验 RP ID 哈希与「用户在场」标志
+func parseAuthData(b []byte, rpID string) (*authData, error) {
+	if len(b) < 37 {
+		return nil, errAuthData
+	}
+	ad := &authData{RPIDHash: b[:32], Flags: b[32], SignCount: binary.BigEndian.Uint32(b[33:37])}
+	want := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(ad.RPIDHash, want[:]) {
+		return nil, fmt.Errorf("rpIdHash mismatch for %q", rpID)
+	}
+	if ad.Flags&flagUserPresent == 0 {
+		return nil, errors.New("user not present")
+	}
+	if ad.Flags&flagAttested == 0 {
+		return ad, nil
+	}
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, errAuthData
+	}
+	n := int(binary.BigEndian.Uint16(rest[16:18])) // 跳过 16 字节 AAGUID
+	rest = rest[18:]
+	if n == 0 || len(rest) < n {
+		return nil, errAuthData
+	}
+	ad.CredID = rest[:n]
+	key, _, err := decodeCBOR(rest[n:])
+	if err != nil {
+		return nil, err
+	}
+	ad.PublicKey, ad.Alg, err = parseCOSEKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return ad, nil
+}
+
+// parseAttestation 解析注册时的 attestationObject，返回其中的 authenticatorData
+func parseAttestation(raw []byte, rpID string) (*authData, error) {
+	v, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errCBOR
+	}
+	if f, _ := m["fmt"].(string); f != "none" {
+		return nil, fmt.Errorf("unsupported attestation format %q", f)
+	}
+	b, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, errAuthData
+	}
+	ad, err := parseAuthData(b, rpID)
+	if err != nil {
+		return nil, err
+	}
+	if ad.CredID == nil {
+		return nil, errors.New("missing attested credential data")
+	}
+	return ad, nil
+}
+
+// parseCOSEKey 将 COSE_Key 转为标准库公钥
+func parseCOSEKey(v interface{}) (crypto.PublicKey, int, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errUnsupported
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == coseES256:
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errUnsupported
+		}
+		// 通过 ecdh 校验点在 P-256 曲线上
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, 0, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, coseES256, nil
+	case kty == 1 && alg == coseEdDSA:
+		x, _ := m[int64(-2)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errUnsupported
+		}
+		return ed25519.PublicKey(x), coseEdDSA, nil
+	case kty == 3 && alg == coseRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errUnsupported
+		}
+		exp := int(new(big.Int).SetBytes(e).Int64())
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, coseRS256, nil
+	}
+	return nil, 0, fmt.Errorf("%w (kty=%d alg=%d)", errUnsupported, kty, alg)
+}
+
+// verifyAssertion 校验登录签名：签名内容为 authenticatorData || SHA-256(clientDataJSON)
+func verifyAssertion(pubDER []byte, authenticatorData, clientDataJSON, sig []byte) error {
+	pub, err := x509.ParsePKIXPublicKey(pubDER)
+	if err != nil {
+		return err
+	}
+	cdHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), cdHash[:]...)
+	digest := sha256.Sum256(signed)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, signed, sig) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errUnsupported
+	}
+	return nil
+}
+
+// decodeCBOR 解析一个 CBOR 数据项，返回值与剩余字节。只支持 WebAuthn 用到的类型：
+// 整数为 int64，字节串为 []byte，文本为 string，数组为 []interface{}，映射为 map[interface{}]interface{}；
+// 不支持不定长编码
+func decodeCBOR(b []byte) (interface{}, []byte, error) {
+	return decodeCBORDepth(b, 0)
+}
+
+func decodeCBORDepth(b []byte, depth int) (interface{}, []byte, error) {
+	if len(b) == 0 || depth > 16 {
+		return nil, nil, errCBOR
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	b = b[1:]
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < size {
+			return nil, nil, errCBOR
+		}
+		for _, c := range b[:size] {
+			n = n<<8 | uint64(c)
+		}
+		b = b[size:]
+	default:
+		return nil, nil, errCBOR
+	}
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return int64(n), b, nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return -1 - int64(n), b, nil
+	case 2, 3:
+		if n > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		if major == 3 {
+			return string(b[:n]), b[n:], nil
+		}
+		return append([]byte{}, b[:n]...), b[n:], nil
+	case 4:
+		if n > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		arr := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var v interface{}
+			var err error
+			if v, b, err = decodeCBORDepth(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, b, nil
+	case 5:
+		if n > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			var k, v interface{}
+			var err error
+			if k, b, err = decodeCBORDepth(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCBOR
+			}
+			if v, b, err = decodeCBORDepth(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, b, nil
+	case 6:
+		return decodeCBORDepth(b, depth+1)
+	default: // 7：false / true / null / 浮点数，WebAuthn 中用不到具体值
+		switch info {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		}
+		return nil, b, nil
+	}
+}
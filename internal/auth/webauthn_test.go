@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testHost   = "localhost:21008"
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:21008"
+)
+
+// softAuthenticator 软件实现的认证器：生成 attestation "none" 的注册数据与登录断言
+type softAuthenticator struct {
+	alg    int
+	credID []byte
+	signer crypto.Signer
+	count  uint32
+}
+
+func newSoftAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+	a := &softAuthenticator{alg: alg, credID: make([]byte, 16)}
+	if _, err := rand.Read(a.credID); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	switch alg {
+	case coseES256:
+		a.signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case coseEdDSA:
+		_, a.signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported alg %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// coseKey 公钥的 COSE_Key 编码
+func (a *softAuthenticator) coseKey() []byte {
+	switch k := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return cborMap(
+			cborInt(1), cborInt(2),
+			cborInt(3), cborInt(coseES256),
+			cborInt(-1), cborInt(1),
+			cborInt(-2), cborBytes(x),
+			cborInt(-3), cborBytes(y),
+		)
+	case ed25519.PublicKey:
+		return cborMap(
+			cborInt(1), cborInt(1),
+			cborInt(3), cborInt(coseEdDSA),
+			cborInt(-1), cborInt(6),
+			cborInt(-2), cborBytes(k),
+		)
+	}
+	return nil
+}
+
+// authData 生成 authenticatorData；attested 时附带凭据 ID 与公钥（注册）
+func (a *softAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	b := append([]byte{}, h[:]...)
+	if attested {
+		flags |= flagAttested
+	}
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, a.count)
+	if attested {
+		b = append(b, make([]byte, 16)...) // AAGUID
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.credID)))
+		b = append(b, a.credID...)
+		b = append(b, a.coseKey()...)
+	}
+	return b
+}
+
+func (a *softAuthenticator) attestation(rpID string) []byte {
+	return cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(rpID, flagUserPresent|flagUserVerified, true)),
+	)
+}
+
+// assert 递增签名计数并对 authenticatorData || SHA-256(clientDataJSON) 签名
+func (a *softAuthenticator) assert(t *testing.T, rpID string, clientDataJSON []byte) (authenticatorData, sig []byte) {
+	t.Helper()
+	a.count++
+	authenticatorData = a.authData(rpID, flagUserPresent|flagUserVerified, false)
+	cdHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), cdHash[:]...)
+	var err error
+	switch k := a.signer.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(signed)
+		sig, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, signed)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticatorData, sig
+}
+
+func clientDataJSON(typ, challenge, origin string) []byte {
+	b, _ := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: origin})
+	return b
+}
+
+// 最小的 CBOR 编码，只覆盖测试用到的类型
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func cborInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+
+func cborText(s string) []byte { return append(cborHead(3, uint64(len(s))), s...) }
+
+func cborMap(kv ...[]byte) []byte {
+	out := cborHead(5, uint64(len(kv)/2))
+	for _, b := range kv {
+		out = append(out, b...)
+	}
+	return out
+}
+
+var testAlgs = []struct {
+	name string
+	alg  int
+}{
+	{"ES256", coseES256},
+	{"Ed25519", coseEdDSA},
+}
+
+func TestParseAttestationAndVerifyAssertion(t *testing.T) {
+	for _, tc := range testAlgs {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newSoftAuthenticator(t, tc.alg)
+			ad, err := parseAttestation(a.attestation(testRPID), testRPID)
+			if err != nil {
+				t.Fatalf("parseAttestation: %v", err)
+			}
+			if ad.Alg != tc.alg || !bytes.Equal(ad.CredID, a.credID) {
+				t.Fatalf("got alg %d cred %x, want %d %x", ad.Alg, ad.CredID, tc.alg, a.credID)
+			}
+			der, err := x509.MarshalPKIXPublicKey(ad.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := x509.MarshalPKIXPublicKey(a.signer.Public())
+			if !bytes.Equal(der, want) {
+				t.Fatal("parsed public key differs from the authenticator key")
+			}
+
+			cd := clientDataJSON("webauthn.get", "challenge", testOrigin)
+			adRaw, sig := a.assert(t, testRPID, cd)
+			if err := verifyAssertion(der, adRaw, cd, sig); err != nil {
+				t.Fatalf("verifyAssertion: %v", err)
+			}
+			other := clientDataJSON("webauthn.get", "other", testOrigin)
+			if err := verifyAssertion(der, adRaw, other, sig); err == nil {
+				t.Fatal("signature accepted for different clientDataJSON")
+			}
+			bad := append([]byte{}, sig...)
+			bad[len(bad)-1] ^= 1
+			if err := verifyAssertion(der, adRaw, cd, bad); err == nil {
+				t.Fatal("tampered signature accepted")
+			}
+		})
+	}
+}
+
+func TestRPIDHashMismatch(t *testing.T) {
+	a := newSoftAuthenticator(t, coseES256)
+	if _, err := parseAttestation(a.attestation("evil.example"), testRPID); err == nil {
+		t.Fatal("attestation for another RP ID accepted")
+	}
+	if _, err := parseAuthData(a.authData("evil.example", flagUserPresent, false), testRPID); err == nil {
+		t.Fatal("assertion for another RP ID accepted")
+	}
+	if _, err := parseAuthData(a.authData(testRPID, 0, false), testRPID); err == nil {
+		t.Fatal("assertion without user presence accepted")
+	}
+}
+
+func TestClientDataOriginMismatch(t *testing.T) {
+	cd := clientDataJSON("webauthn.get", "abc", "http://evil.example:21008")
+	if _, err := parseClientData(cd, "webauthn.get", testOrigin); err == nil {
+		t.Fatal("clientData from another origin accepted")
+	}
+	cd = clientDataJSON("webauthn.create", "abc", testOrigin)
+	if _, err := parseClientData(cd, "webauthn.get", testOrigin); err == nil {
+		t.Fatal("clientData of another type accepted")
+	}
+	ch, err := parseClientData(clientDataJSON("webauthn.get", "abc", testOrigin), "webauthn.get", testOrigin)
+	if err != nil || ch != "abc" {
+		t.Fatalf("got %q, %v", ch, err)
+	}
+}
+
+func TestChallengeSingleUse(t *testing.T) {
+	ch, err := newChallenge("register", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !takeChallenge(ch, "register", "alice") {
+		t.Fatal("fresh challenge rejected")
+	}
+	if takeChallenge(ch, "register", "alice") {
+		t.Fatal("challenge accepted twice")
+	}
+	ch, _ = newChallenge("register", "alice")
+	if takeChallenge(ch, "login", "") {
+		t.Fatal("register challenge accepted for login")
+	}
+	if takeChallenge(ch, "register", "alice") {
+		t.Fatal("challenge still usable after a rejected attempt")
+	}
+}
+
+// TestPasskeyRegisterAndLogin 经 HTTP 处理函数完成注册与登录，并检查 challenge 重放、来源不符与签名计数回退
+func TestPasskeyRegisterAndLogin(t *testing.T) {
+	for _, tc := range testAlgs {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("HOME", dir)
+			t.Setenv("XDG_CONFIG_HOME", dir)
+			if err := CreateUser("alice", "correct-horse", RoleAdmin, nil); err != nil {
+				t.Fatal(err)
+			}
+			a := newSoftAuthenticator(t, tc.alg)
+
+			ch, err := newChallenge("register", "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			reg := PasskeyRegisterReq{
+				Name:              "test",
+				ClientDataJSON:    b64url.EncodeToString(clientDataJSON("webauthn.create", ch, testOrigin)),
+				AttestationObject: b64url.EncodeToString(a.attestation(testRPID)),
+			}
+			w := httptest.NewRecorder()
+			registerFinish(w, passkeyRequest(t, "/api/auth/passkeys/register/finish", reg), &User{Name: "alice"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("register: %d %s", w.Code, w.Body)
+			}
+			w = httptest.NewRecorder()
+			registerFinish(w, passkeyRequest(t, "/api/auth/passkeys/register/finish", reg), &User{Name: "alice"})
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("register with reused challenge: %d, want 400", w.Code)
+			}
+
+			login := func(origin string) PasskeyLoginReq {
+				ch, err := newChallenge("login", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				cd := clientDataJSON("webauthn.get", ch, origin)
+				adRaw, sig := a.assert(t, testRPID, cd)
+				return PasskeyLoginReq{
+					ID:                b64url.EncodeToString(a.credID),
+					ClientDataJSON:    b64url.EncodeToString(cd),
+					AuthenticatorData: b64url.EncodeToString(adRaw),
+					Signature:         b64url.EncodeToString(sig),
+				}
+			}
+			finish := func(req PasskeyLoginReq) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				loginFinish(w, passkeyRequest(t, "/api/auth/passkey/finish", req))
+				return w
+			}
+
+			req := login(testOrigin)
+			if w := finish(req); w.Code != http.StatusOK {
+				t.Fatalf("login: %d %s", w.Code, w.Body)
+			}
+			if w := finish(req); w.Code != http.StatusBadRequest {
+				t.Fatalf("replayed assertion: %d, want 400", w.Code)
+			}
+
+			req = login("http://evil.example:21008")
+			if w := finish(req); w.Code != http.StatusBadRequest {
+				t.Fatalf("assertion from another origin: %d, want 400", w.Code)
+			}
+
+			// 认证器被复制：副本的计数落后于已记录的值
+			a.count -= 3
+			req = login(testOrigin)
+			if w := finish(req); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "签名计数") {
+				t.Fatalf("sign count regression: %d %s, want 401", w.Code, w.Body)
+			}
+			a.count += 10
+			req = login(testOrigin)
+			if w := finish(req); w.Code != http.StatusOK {
+				t.Fatalf("login after count advanced: %d %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func passkeyRequest(t *testing.T, path string, body interface{}) *http.Request {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(b)))
+	r.Host = testHost
+	return r
+}
@@ -0,0 +1,330 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+
+	"lwshell/internal/models"
+)
+
+const (
+	version = 1
+	kdfName = "scrypt"
+	// scrypt 参数：N=2^15, r=8, p=1（约 32MB 内存），与 age 的默认强度相当
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32 // AES-256
+)
+
+var (
+	ErrPassphraseRequired = errors.New("passphrase required")
+	ErrWrongPassphrase    = errors.New("口令错误或文件已损坏")
+)
+
+// Bundle 加密导出包的明文内容
+type Bundle struct {
+	Config     *models.Config `json:"config"`
+	Keys       []KeyFile      `json:"keys,omitempty"`        // 服务器引用的私钥文件
+	KnownHosts string         `json:"known_hosts,omitempty"` // ~/.ssh/known_hosts 内容
+}
+
+// KeyFile 打包的私钥文件，Path 为导出时的原始路径
+type KeyFile struct {
+	Path string `json:"path"`
+	Data []byte `json:"data"`
+}
+
+// envelope 加密包的外层格式（JSON），除 ciphertext 外均为明文参数
+type envelope struct {
+	Version    int    `json:"lwshell_bundle"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// IsBundle 判断内容是否为加密导出包
+func IsBundle(data []byte) bool {
+	if !bytes.Contains(data, []byte(`"lwshell_bundle"`)) {
+		return false
+	}
+	var env envelope
+	return json.Unmarshal(data, &env) == nil && env.Version > 0 && len(env.Ciphertext) > 0
+}
+
+// Seal 用口令加密导出包：scrypt 派生密钥，AES-256-GCM 加密
+func Seal(b *Bundle, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	plain, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	env := envelope{Version: version, KDF: kdfName, N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, &env)
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = gcm.Seal(nil, env.Nonce, plain, []byte(kdfName))
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Open 用口令解密导出包
+func Open(data []byte, passphrase string) (*Bundle, error) {
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("解析加密包失败: %w", err)
+	}
+	if env.Version != version || env.KDF != kdfName {
+		return nil, fmt.Errorf("不支持的加密包版本: %d/%s", env.Version, env.KDF)
+	}
+	gcm, err := newGCM(passphrase, &env)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, env.Nonce, env.Ciphertext, []byte(kdfName))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	var b Bundle
+	if err := json.Unmarshal(plain, &b); err != nil {
+		return nil, fmt.Errorf("解析加密包内容失败: %w", err)
+	}
+	if b.Config == nil {
+		b.Config = &models.Config{Servers: []models.Server{}}
+	}
+	return &b, nil
+}
+
+func newGCM(passphrase string, env *envelope) (cipher.AEAD, error) {
+	// 限制参数上限，避免恶意文件让 scrypt 耗尽内存
+	if env.N <= 1 || env.N > 1<<20 || env.R <= 0 || env.R > 32 || env.P <= 0 || env.P > 16 {
+		return nil, fmt.Errorf("加密包参数无效")
+	}
+	key, err := scrypt.Key([]byte(passphrase), env.Salt, env.N, env.R, env.P, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Build 由当前配置生成导出包，可选附带私钥文件与 known_hosts；读取失败或不在 ~/.ssh、keys/ 目录下的私钥返回在 missing 中
+func Build(cfg *models.Config, withKeys, withKnownHosts bool) (b *Bundle, missing []string) {
+	b = &Bundle{Config: cfg}
+	if withKeys {
+		seen := make(map[string]bool)
+		// 按生效配置收集，包含模板中的私钥
+		for _, s := range cfg.ResolvedServers() {
+			if s.KeyPath == "" || seen[s.KeyPath] {
+				continue
+			}
+			seen[s.KeyPath] = true
+			if !keyPathAllowed(s.KeyPath) {
+				missing = append(missing, s.KeyPath)
+				continue
+			}
+			data, err := os.ReadFile(s.KeyPath)
+			if err != nil {
+				missing = append(missing, s.KeyPath)
+				continue
+			}
+			b.Keys = append(b.Keys, KeyFile{Path: s.KeyPath, Data: data})
+		}
+	}
+	if withKnownHosts {
+		if p, err := knownHostsPath(); err == nil {
+			if data, err := os.ReadFile(p); err == nil {
+				b.KnownHosts = string(data)
+			}
+		}
+	}
+	return b, missing
+}
+
+// keyPathAllowed 只打包 ~/.ssh 与 keys 目录下的文件：私钥路径可由有编辑权限的用户填写，
+// 不限制时可借导出读取配置目录中的用户数据等任意文件。按解析符号链接后的真实路径判断
+func keyPathAllowed(p string) bool {
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return false
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return false
+	}
+	var roots []string
+	if home, err := os.UserHomeDir(); err == nil {
+		roots = append(roots, filepath.Join(home, ".ssh"))
+	}
+	if dir, err := keysDir(); err == nil {
+		roots = append(roots, dir)
+	}
+	for _, root := range roots {
+		if r, err := filepath.EvalSymlinks(root); err == nil {
+			root = r
+		}
+		if rel, err := filepath.Rel(root, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && rel != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// keysDir 导入的私钥存放目录：os.UserConfigDir()/lwshell/keys
+func keysDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lwshell", "keys"), nil
+}
+
+func knownHostsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// KeyDestinations 计算每个打包私钥在本机的保存路径（keys 目录下）。包内重名、或本机已有同名但内容不同的文件时追加序号，
+// 不会覆盖其他服务器仍在使用的私钥；本机已有内容相同的文件时直接沿用
+func (b *Bundle) KeyDestinations() (map[string]string, error) {
+	dir, err := keysDir()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(b.Keys))
+	used := make(map[string]bool)
+	for _, k := range b.Keys {
+		base := filepath.Base(strings.ReplaceAll(k.Path, `\`, "/"))
+		name := base
+		for i := 2; ; i++ {
+			if !used[name] {
+				existing, err := os.ReadFile(filepath.Join(dir, name))
+				if os.IsNotExist(err) || (err == nil && bytes.Equal(existing, k.Data)) {
+					break
+				}
+			}
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[name] = true
+		out[k.Path] = filepath.Join(dir, name)
+	}
+	return out, nil
+}
+
+// RestoreKeys 将打包的私钥写入 KeyDestinations 给出的路径（权限 0600）；只创建新文件，已存在且内容相同的文件跳过
+func (b *Bundle) RestoreKeys() error {
+	dest, err := b.KeyDestinations()
+	if err != nil {
+		return err
+	}
+	for _, k := range b.Keys {
+		p := dest[k.Path]
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			return err
+		}
+		if err := writeNewFile(p, k.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNewFile 以 O_EXCL 创建文件；文件已存在时内容相同视为成功，不同则报错而不覆盖
+func writeNewFile(p string, data []byte) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		existing, rerr := os.ReadFile(p)
+		if rerr == nil && bytes.Equal(existing, data) {
+			return nil
+		}
+		return fmt.Errorf("私钥文件已存在且内容不同，未覆盖: %s", p)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(p)
+		return err
+	}
+	return f.Close()
+}
+
+// RestoreKnownHosts 将打包的 known_hosts 中本机尚不存在的行追加到 ~/.ssh/known_hosts，返回追加的行数
+func (b *Bundle) RestoreKnownHosts() (int, error) {
+	if strings.TrimSpace(b.KnownHosts) == "" {
+		return 0, nil
+	}
+	p, err := knownHostsPath()
+	if err != nil {
+		return 0, err
+	}
+	existing, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+	var add []string
+	for _, line := range strings.Split(b.KnownHosts, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || have[line] {
+			continue
+		}
+		have[line] = true
+		add = append(add, line)
+	}
+	if len(add) == 0 {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	prefix := ""
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		prefix = "\n"
+	}
+	if _, err := f.WriteString(prefix + strings.Join(add, "\n") + "\n"); err != nil {
+		return 0, err
+	}
+	return len(add), nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"lwshell/internal/models"
+)
+
+// MaxBackups 保留的快照数量，可通过 --backup-keep 调整；<= 0 时不生成快照
+var MaxBackups = 20
+
+const (
+	backupPrefix = "servers-"
+	backupSuffix = ".json"
+	// backupTimeLayout 快照名称中的时间（UTC，精确到毫秒，按字典序即按时间排序）
+	backupTimeLayout = "20060102-150405.000"
+)
+
+// Backup 一个配置快照
+type Backup struct {
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
+	Servers int       `json:"servers"` // 快照中的服务器数量
+}
+
+// newBackupName 生成快照名称；同一毫秒内已存在同名快照时顺延 1 毫秒，保证名称唯一且有序
+func newBackupName(exists func(name string) bool) string {
+	t := time.Now().UTC()
+	for {
+		name := backupPrefix + t.Format(backupTimeLayout) + backupSuffix
+		if !exists(name) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// onlyUsageChanged 判断两份配置 JSON 是否仅有服务器的最近连接时间不同；此类变化（每次连接都会发生）不生成快照，
+// 避免挤掉真正的修改记录
+func onlyUsageChanged(old, next []byte) bool {
+	var a, b models.Config
+	if json.Unmarshal(old, &a) != nil || json.Unmarshal(next, &b) != nil {
+		return false
+	}
+	for _, cfg := range []*models.Config{&a, &b} {
+		for i := range cfg.Servers {
+			cfg.Servers[i].LastConnected = nil
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// backupTime 从快照名称解析时间
+func backupTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+	return t, err == nil
+}
+
+func validBackupName(name string) bool {
+	_, ok := backupTime(name)
+	return ok
+}
+
+// ListBackups 列出所有快照，最新的在前
+func ListBackups() ([]Backup, error) {
+	s, err := current()
+	if err != nil {
+		return nil, err
+	}
+	return s.Backups()
+}
+
+// LoadBackup 读取指定快照；name 须为 ListBackups 返回的名称
+func LoadBackup(name string) (*models.Config, error) {
+	s, err := current()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.LoadBackup(name)
+	if err != nil {
+		return nil, err
+	}
+	normalize(cfg)
+	return cfg, nil
+}
+
+// RestoreBackup 用指定快照覆盖当前配置；覆盖前的配置同样会留下快照，因此恢复本身可以撤销
+func RestoreBackup(name string) (*models.Config, error) {
+	cfg, err := LoadBackup(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := Save(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+
+	"lwshell/internal/models"
+)
+
+// NewID 生成随机 UUID（v4）作为服务器 ID
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err) // crypto/rand 不可用时无法安全生成 ID
+	}
+	return formatUUID(b, 4)
+}
+
+// contentID 为手工添加、缺少 id 的条目生成由内容决定的 UUID（v5 风格），重复读取得到相同 ID，直到下次保存时写入
+func contentID(s models.Server, index int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("lwshell\x00%d\x00%s\x00%s\x00%d\x00%s", index, s.Name, s.Host, s.Port, s.User)))
+	var b [16]byte
+	copy(b[:], sum[:16])
+	return formatUUID(b, 5)
+}
+
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 变体
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// IsUUID 判断是否为 8-4-4-4-12 格式的 UUID
+func IsUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// migrateIDs 将非 UUID 的 ID（旧版自增数字）替换为新的 UUID，原 ID 记入 Aliases，
+// 使书签、命令行 --connect-id 与旧导出文件中的 ID 仍能找到对应服务器；返回是否有修改
+func migrateIDs(cfg *models.Config) bool {
+	changed := false
+	for i := range cfg.Servers {
+		s := &cfg.Servers[i]
+		if IsUUID(s.ID) {
+			continue
+		}
+		if s.ID != "" {
+			s.Aliases = appendUnique(s.Aliases, s.ID)
+		}
+		s.ID = NewID()
+		changed = true
+	}
+	return changed
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, x := range list {
+		if x == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
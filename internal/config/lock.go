@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// mu 进程内互斥；文件锁（flock / LockFileEx）负责与其他 lwshell 进程（如命令行导入）互斥
+var mu sync.Mutex
+
+// lock 获取配置写锁，返回释放函数。锁文件为配置目录下的 .lock
+func lock() (func(), error) {
+	mu.Lock()
+	dir, err := configDir()
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+		mu.Unlock()
+	}, nil
+}
+
+// WriteFileAtomic 先写入同目录下的临时文件并 fsync，再 rename 覆盖目标，
+// 保证读者只会看到完整的旧文件或新文件；最后 fsync 目录使 rename 落盘。auth 包的用户、令牌等文件同样使用
+func WriteFileAtomic(p string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(p)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(p)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // rename 成功后为空操作
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
@@ -1,87 +1,128 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"lwshell/internal/models"
 )
 
-// configPath 配置文件路径：os.UserConfigDir()/lwshell/servers.json
-// macOS 为 ~/Library/Application Support/lwshell/servers.json，Linux 为 ~/.config/lwshell/servers.json
-func configPath() (string, error) {
-	dir, err := os.UserConfigDir()
-	if err != nil {
-		return "", err
-	}
-	p := filepath.Join(dir, "lwshell", "servers.json")
-	return p, nil
-}
+// 配置目录：os.UserConfigDir()/lwshell，macOS 为 ~/Library/Application Support/lwshell，Linux 为 ~/.config/lwshell；
+// 默认使用其中的 servers.json，也可通过 lwshell migrate 切换为 SQLite（lwshell.db），见 store.go
 
-// Load 从默认路径加载配置
+// Load 从当前存储后端加载配置
 func Load() (*models.Config, error) {
-	p, err := configPath()
-	if err != nil {
-		return nil, err
-	}
-	data, err := os.ReadFile(p)
+	s, err := current()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return &models.Config{Servers: []models.Server{}}, nil
-		}
 		return nil, err
 	}
-	var cfg models.Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("解析配置失败: %w", err)
-	}
-	if cfg.Servers == nil {
-		cfg.Servers = []models.Server{}
-	}
-	// 为没有 ID 的旧数据补全唯一 ID
-	max := 0
-	for _, s := range cfg.Servers {
-		if s.ID != "" {
-			n := parseNum(s.ID)
-			if n > max {
-				max = n
-			}
-		}
-	}
-	for i := range cfg.Servers {
-		if cfg.Servers[i].ID == "" {
-			max++
-			cfg.Servers[i].ID = fmt.Sprintf("%d", max)
-		}
-	}
-	return &cfg, nil
+	return s.Load()
 }
 
-func parseNum(s string) int {
-	n := 0
-	for _, c := range s {
-		if c >= '0' && c <= '9' {
-			n = n*10 + int(c-'0')
-		}
-	}
-	return n
-}
+// ErrConflict 修改基于的版本已过期（其他窗口或进程先修改了同一台服务器）
+var ErrConflict = errors.New("服务器已被修改，请刷新后重试")
 
-// Save 保存配置到默认路径
+// Save 保存配置；持有写锁，非 UUID 的 ID 会迁移为 UUID（见 id.go），覆盖前保留原配置为快照（见 backup.go）。
+// 基于已有配置的修改应使用 Update，避免「读取—修改—保存」期间被其他请求覆盖
 func Save(cfg *models.Config) error {
-	p, err := configPath()
+	s, unlock, err := lockCurrent()
 	if err != nil {
 		return err
 	}
-	dir := filepath.Dir(p)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	defer unlock()
+	migrateIDs(cfg)
+	return s.Save(cfg)
+}
+
+// Update 在写锁内读取配置、调用 fn 修改并保存；fn 返回错误时不保存并原样返回该错误
+func Update(fn func(cfg *models.Config) error) error {
+	s, unlock, err := lockCurrent()
+	if err != nil {
 		return err
 	}
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	defer unlock()
+	cfg, err := s.Load()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(p, data, 0600)
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	migrateIDs(cfg)
+	return s.Save(cfg)
+}
+
+// Revision 服务器条目的版本号，用作 ETag：除最近连接时间外任一字段变化都会改变，
+// 连接服务器不会使其他窗口中正在进行的编辑产生冲突。版本号会发给所有能查看该服务器的用户，
+// 因此用服务端密钥做 HMAC，无法据此离线猜测其中的密码
+func Revision(s models.Server) string {
+	s.LastConnected = nil
+	key, err := revisionKey()
+	if err != nil {
+		s.Password = "" // 取不到密钥时不让密码参与计算，只是修改密码不再改变版本号
+	}
+	data, _ := json.Marshal(s)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+var (
+	revKey     []byte
+	revKeyErr  error
+	revKeyOnce sync.Once
+)
+
+// revisionKey 计算版本号的密钥，首次使用时生成并保存在配置目录的 .revision_key（0600）
+func revisionKey() ([]byte, error) {
+	revKeyOnce.Do(func() {
+		dir, err := configDir()
+		if err != nil {
+			revKeyErr = err
+			return
+		}
+		p := filepath.Join(dir, ".revision_key")
+		if data, err := os.ReadFile(p); err == nil {
+			if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+				revKey = key
+				return
+			}
+		}
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			revKeyErr = err
+			return
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			revKeyErr = err
+			return
+		}
+		if err := WriteFileAtomic(p, []byte(hex.EncodeToString(key)), 0600); err != nil {
+			revKeyErr = err
+			return
+		}
+		revKey = key
+	})
+	return revKey, revKeyErr
+}
+
+// Touch 记录服务器最近一次成功连接的时间；id 可为曾用 ID，服务器不存在时忽略。
+// 只有连接时间变化时不生成快照（见 backup.go）
+func Touch(id string, t time.Time) error {
+	t = t.UTC().Truncate(time.Second)
+	return Update(func(cfg *models.Config) error {
+		if s := cfg.Find(id); s != nil && (s.LastConnected == nil || s.LastConnected.Before(t)) {
+			s.LastConnected = &t
+		}
+		return nil
+	})
 }
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lwshell/internal/models"
+)
+
+// 存储后端名称
+const (
+	BackendJSON   = "json"
+	BackendSQLite = "sqlite"
+)
+
+// Store 服务器配置的存储后端。Save 由调用方在写锁内调用，并负责在覆盖前保留历史版本（见 MaxBackups）
+type Store interface {
+	Load() (*models.Config, error)
+	Save(cfg *models.Config) error
+	// Backups 列出历史版本，最新的在前
+	Backups() ([]Backup, error)
+	LoadBackup(name string) (*models.Config, error)
+	// AddBackup 以指定名称（即快照时间）写入一条历史版本，不改变当前配置；用于迁移时保留原有快照的时间
+	AddBackup(name string, cfg *models.Config) error
+	Close() error
+}
+
+// EventStore 支持记录与查询访问事件的后端（SQLite）；JSON 后端的访问记录只写 access.log
+type EventStore interface {
+	AddEvent(e Event) error
+	// Events 按时间倒序返回事件；serverID 为空时返回全部，limit <= 0 时不限制
+	Events(serverID string, limit int) ([]Event, error)
+}
+
+// Event 一条访问事件（与 access.log 中的一行对应）
+type Event struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Actor    string    `json:"actor,omitempty"` // 操作的 Web 用户
+	ServerID string    `json:"server_id,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	Port     int       `json:"port,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Status   string    `json:"status"`
+	Err      string    `json:"err,omitempty"`
+}
+
+// storageSettings lwshell/storage.json：选择存储后端，缺省为 JSON 文件
+type storageSettings struct {
+	Backend string `json:"backend"`
+}
+
+var (
+	store     Store
+	storeName string // store 对应的后端名称
+	storeMu   sync.Mutex
+)
+
+// configDir 配置目录：os.UserConfigDir()/lwshell
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lwshell"), nil
+}
+
+func settingsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "storage.json"), nil
+}
+
+// Backend 返回当前配置的存储后端名称
+func Backend() string {
+	p, err := settingsPath()
+	if err != nil {
+		return BackendJSON
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return BackendJSON
+	}
+	var st storageSettings
+	if json.Unmarshal(data, &st) != nil || st.Backend == "" {
+		return BackendJSON
+	}
+	return st.Backend
+}
+
+func setBackend(name string) error {
+	p, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(storageSettings{Backend: name}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(p, data, 0600)
+}
+
+// openStore 按名称打开存储后端
+func openStore(name string) (Store, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case BackendJSON:
+		return newJSONStore(dir), nil
+	case BackendSQLite:
+		return openSQLiteStore(filepath.Join(dir, "lwshell.db"))
+	default:
+		return nil, fmt.Errorf("未知的存储后端: %s", name)
+	}
+}
+
+// current 返回当前使用的存储后端。每次都按 storage.json 检查，其他进程执行 lwshell migrate 后，
+// 正在运行的 Web 服务随即改用新的后端，不会继续写入旧后端
+func current() (Store, error) {
+	name := Backend()
+	storeMu.Lock()
+	if store != nil && storeName == name {
+		s := store
+		storeMu.Unlock()
+		return s, nil
+	}
+	storeMu.Unlock()
+	s, err := openStore(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateStoreIDs(s); err != nil {
+		s.Close()
+		return nil, err
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if store != nil && storeName == name {
+		s.Close() // 其他请求已先打开
+		return store, nil
+	}
+	// 旧后端可能仍有请求正在使用，不关闭
+	store, storeName = s, name
+	return s, nil
+}
+
+// lockCurrent 获取写锁并返回当前后端；等待写锁期间后端被切换（迁移持有写锁）时改用新的后端
+func lockCurrent() (Store, func(), error) {
+	for {
+		s, err := current()
+		if err != nil {
+			return nil, nil, err
+		}
+		unlock, err := lock()
+		if err != nil {
+			return nil, nil, err
+		}
+		name := Backend()
+		storeMu.Lock()
+		same := store == s && storeName == name
+		storeMu.Unlock()
+		if same {
+			return s, unlock, nil
+		}
+		unlock()
+	}
+}
+
+// migrateStoreIDs 首次打开后端时将旧版数字 ID 迁移为 UUID 并保存（调用方不能持有写锁）
+func migrateStoreIDs(s Store) error {
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cfg, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if !migrateIDs(cfg) {
+		return nil
+	}
+	return s.Save(cfg)
+}
+
+// AddEvent 记录访问事件；当前后端不支持事件存储时忽略
+func AddEvent(e Event) error {
+	s, err := current()
+	if err != nil {
+		return err
+	}
+	if es, ok := s.(EventStore); ok {
+		return es.AddEvent(e)
+	}
+	return nil
+}
+
+// Events 查询访问事件；当前后端不支持时返回 ok=false
+func Events(serverID string, limit int) (events []Event, ok bool, err error) {
+	s, err := current()
+	if err != nil {
+		return nil, false, err
+	}
+	es, ok := s.(EventStore)
+	if !ok {
+		return nil, false, nil
+	}
+	events, err = es.Events(serverID, limit)
+	return events, true, err
+}
+
+// Migrate 将当前后端中的配置与历史版本复制到 to 后端，并切换 storage.json；
+// 源数据保留不删除，切换回原后端即可回退。返回迁移的服务器数量
+func Migrate(to string) (int, error) {
+	if Backend() == to {
+		return 0, fmt.Errorf("当前已使用 %s 存储", to)
+	}
+	src, unlock, err := lockCurrent()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	dst, err := openStore(to)
+	if err != nil {
+		return 0, err
+	}
+	cfg, err := src.Load()
+	if err != nil {
+		dst.Close()
+		return 0, err
+	}
+	// 历史版本按原名称（即原快照时间）复制，不会被记为迁移时刻；目标中已有的同名快照（如重复迁移）跳过
+	backups, err := src.Backups()
+	if err != nil {
+		dst.Close()
+		return 0, err
+	}
+	existing, err := dst.Backups()
+	if err != nil {
+		dst.Close()
+		return 0, err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, b := range existing {
+		have[b.Name] = true
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		if have[backups[i].Name] {
+			continue
+		}
+		old, err := src.LoadBackup(backups[i].Name)
+		if err != nil {
+			continue
+		}
+		if err := dst.AddBackup(backups[i].Name, old); err != nil {
+			dst.Close()
+			return 0, err
+		}
+	}
+	if err := dst.Save(cfg); err != nil {
+		dst.Close()
+		return 0, err
+	}
+	if err := setBackend(to); err != nil {
+		dst.Close()
+		return 0, err
+	}
+	// 与 current() 相同，旧后端可能仍有请求正在使用，不关闭
+	storeMu.Lock()
+	store, storeName = dst, to
+	storeMu.Unlock()
+	return len(cfg.Servers), nil
+}
+
+// normalize 补全空列表，并为缺少 id 的条目（如手工编辑添加）补全由内容决定的 ID
+func normalize(cfg *models.Config) {
+	if cfg.Servers == nil {
+		cfg.Servers = []models.Server{}
+	}
+	for i := range cfg.Servers {
+		if cfg.Servers[i].ID == "" {
+			cfg.Servers[i].ID = contentID(cfg.Servers[i], i)
+		}
+	}
+}
+
+// clone 复制配置（含每台服务器的切片与 map 字段），避免调用方修改后端缓存
+func clone(cfg *models.Config) *models.Config {
+	out := *cfg
+	out.Servers = append([]models.Server(nil), cfg.Servers...)
+	out.Templates = append([]models.Template(nil), cfg.Templates...)
+	for i := range out.Servers {
+		out.Servers[i].Aliases = append([]string(nil), out.Servers[i].Aliases...)
+		out.Servers[i].Tags = append([]string(nil), out.Servers[i].Tags...)
+		if f := out.Servers[i].Fields; f != nil {
+			out.Servers[i].Fields = make(map[string]string, len(f))
+			for k, v := range f {
+				out.Servers[i].Fields[k] = v
+			}
+		}
+	}
+	return &out
+}
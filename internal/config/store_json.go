@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"lwshell/internal/models"
+)
+
+// jsonStore 默认后端：servers.json，快照保存在 backups/ 目录。
+// 按文件修改时间与大小缓存解析结果，文件未变化时不重复读取
+type jsonStore struct {
+	path      string
+	backupDir string
+
+	mu      sync.Mutex
+	cached  *models.Config
+	modTime time.Time
+	size    int64
+}
+
+func newJSONStore(dir string) *jsonStore {
+	return &jsonStore{
+		path:      filepath.Join(dir, "servers.json"),
+		backupDir: filepath.Join(dir, "backups"),
+	}
+}
+
+func (j *jsonStore) Load() (*models.Config, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fi, err := os.Stat(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			j.cached = nil
+			return &models.Config{Servers: []models.Server{}}, nil
+		}
+		return nil, err
+	}
+	if j.cached != nil && fi.ModTime().Equal(j.modTime) && fi.Size() == j.size {
+		return clone(j.cached), nil
+	}
+	cfg, err := readConfigFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+	j.cached, j.modTime, j.size = cfg, fi.ModTime(), fi.Size()
+	return clone(cfg), nil
+}
+
+func (j *jsonStore) Save(cfg *models.Config) error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := j.snapshot(data); err != nil {
+		return fmt.Errorf("保存快照失败: %w", err)
+	}
+	return WriteFileAtomic(j.path, data, 0600)
+}
+
+// snapshot 在覆盖 servers.json 之前保存其当前内容；内容未变化（或仅连接时间变化）、文件不存在时不生成快照
+func (j *jsonStore) snapshot(next []byte) error {
+	if MaxBackups <= 0 {
+		return nil
+	}
+	old, err := os.ReadFile(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(bytes.TrimSpace(old)) == 0 || bytes.Equal(old, next) || onlyUsageChanged(old, next) {
+		return nil
+	}
+	if err := os.MkdirAll(j.backupDir, 0700); err != nil {
+		return err
+	}
+	name := newBackupName(func(name string) bool {
+		_, err := os.Stat(filepath.Join(j.backupDir, name))
+		return err == nil
+	})
+	if err := os.WriteFile(filepath.Join(j.backupDir, name), old, 0600); err != nil {
+		return err
+	}
+	return j.prune()
+}
+
+// prune 删除超出 MaxBackups 的最旧快照
+func (j *jsonStore) prune() error {
+	names, err := j.backupNames()
+	if err != nil {
+		return err
+	}
+	for len(names) > MaxBackups {
+		if err := os.Remove(filepath.Join(j.backupDir, names[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// backupNames 返回快照文件名，按时间升序
+func (j *jsonStore) backupNames() ([]string, error) {
+	entries, err := os.ReadDir(j.backupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && validBackupName(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (j *jsonStore) Backups() ([]Backup, error) {
+	names, err := j.backupNames()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Backup, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+		b := Backup{Name: name}
+		b.Time, _ = backupTime(name)
+		if fi, err := os.Stat(filepath.Join(j.backupDir, name)); err == nil {
+			b.Size = fi.Size()
+		}
+		if cfg, err := j.LoadBackup(name); err == nil {
+			b.Servers = len(cfg.Servers)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func (j *jsonStore) LoadBackup(name string) (*models.Config, error) {
+	if !validBackupName(name) {
+		return nil, fmt.Errorf("无效的快照名称: %s", name)
+	}
+	cfg, err := readConfigFile(filepath.Join(j.backupDir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("快照不存在: %s", name)
+	}
+	return cfg, err
+}
+
+func (j *jsonStore) AddBackup(name string, cfg *models.Config) error {
+	if !validBackupName(name) {
+		return fmt.Errorf("无效的快照名称: %s", name)
+	}
+	if MaxBackups <= 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(j.backupDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(j.backupDir, name), data, 0600); err != nil {
+		return err
+	}
+	return j.prune()
+}
+
+func (j *jsonStore) Close() error { return nil }
+
+func readConfigFile(p string) (*models.Config, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var cfg models.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	normalize(&cfg)
+	return &cfg, nil
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lwshell/internal/models"
+
+	_ "modernc.org/sqlite" // 纯 Go 实现的 SQLite 驱动，无需 cgo
+)
+
+// sqliteSchema servers 表的常用字段单独成列以便建索引，data 列保存完整的服务器 JSON（含密码），
+// 新增字段无需改表；meta 中 config 键保存 servers 以外的配置
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS servers (
+	id    TEXT PRIMARY KEY,
+	pos   INTEGER NOT NULL,
+	name  TEXT NOT NULL,
+	host  TEXT NOT NULL,
+	port  INTEGER NOT NULL,
+	user  TEXT NOT NULL,
+	grp   TEXT NOT NULL DEFAULT '',
+	data  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_servers_name ON servers(name);
+CREATE INDEX IF NOT EXISTS idx_servers_host ON servers(host, port, user);
+CREATE INDEX IF NOT EXISTS idx_servers_grp ON servers(grp);
+CREATE TABLE IF NOT EXISTS tags (
+	server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+	tag       TEXT NOT NULL,
+	PRIMARY KEY (server_id, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_tags_tag ON tags(tag);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS history (
+	name    TEXT PRIMARY KEY,
+	time    TEXT NOT NULL,
+	servers INTEGER NOT NULL,
+	data    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_events (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	time      TEXT NOT NULL,
+	action    TEXT NOT NULL,
+	server_id TEXT NOT NULL DEFAULT '',
+	name      TEXT NOT NULL DEFAULT '',
+	host      TEXT NOT NULL DEFAULT '',
+	port      INTEGER NOT NULL DEFAULT 0,
+	user      TEXT NOT NULL DEFAULT '',
+	status    TEXT NOT NULL DEFAULT '',
+	err       TEXT NOT NULL DEFAULT '',
+	actor     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_audit_time ON audit_events(time);
+CREATE INDEX IF NOT EXISTS idx_audit_server ON audit_events(server_id, time);
+`
+
+// sqliteStore SQLite 后端：lwshell.db，保存服务器、标签、历史版本与访问事件
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(p string) (*sqliteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return nil, err
+	}
+	// 数据库含明文密码，先以 0600 创建文件
+	if f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0600); err == nil {
+		f.Close()
+	}
+	db, err := sql.Open("sqlite", p+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	// 旧版数据库补充后来新增的列
+	if err := addColumn(db, "audit_events", "actor", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("升级数据库失败: %w", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// addColumn 表中没有 column 列时添加
+func addColumn(db *sql.DB, table, column, def string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, def))
+	return err
+}
+
+// queryer *sql.DB 与 *sql.Tx 的公共部分
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (s *sqliteStore) Load() (*models.Config, error) {
+	cfg, _, err := loadSQLite(s.db)
+	return cfg, err
+}
+
+// loadSQLite 读取配置；exists 表示数据库中是否已保存过配置
+func loadSQLite(q queryer) (cfg *models.Config, exists bool, err error) {
+	cfg = &models.Config{}
+	var meta string
+	switch err := q.QueryRow(`SELECT value FROM meta WHERE key = 'config'`).Scan(&meta); err {
+	case nil:
+		exists = true
+		if err := json.Unmarshal([]byte(meta), cfg); err != nil {
+			return nil, false, fmt.Errorf("解析配置失败: %w", err)
+		}
+	case sql.ErrNoRows:
+	default:
+		return nil, false, err
+	}
+	rows, err := q.Query(`SELECT data FROM servers ORDER BY pos`)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	cfg.Servers = []models.Server{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, false, err
+		}
+		var srv models.Server
+		if err := json.Unmarshal([]byte(data), &srv); err != nil {
+			return nil, false, fmt.Errorf("解析服务器失败: %w", err)
+		}
+		cfg.Servers = append(cfg.Servers, srv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	normalize(cfg)
+	return cfg, exists, nil
+}
+
+func (s *sqliteStore) Save(cfg *models.Config) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	next, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	prev, exists, err := loadSQLite(tx)
+	if err != nil {
+		return err
+	}
+	if exists && MaxBackups > 0 {
+		old, err := json.MarshalIndent(prev, "", "  ")
+		if err != nil {
+			return err
+		}
+		if string(old) != string(next) && !onlyUsageChanged(old, next) {
+			if err := s.addHistory(tx, old, len(prev.Servers)); err != nil {
+				return fmt.Errorf("保存快照失败: %w", err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tags`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM servers`); err != nil {
+		return err
+	}
+	for i, srv := range cfg.Servers {
+		data, err := json.Marshal(srv)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO servers (id, pos, name, host, port, user, grp, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			srv.ID, i, srv.Name, srv.Host, srv.Port, srv.User, srv.Group, string(data)); err != nil {
+			return fmt.Errorf("保存服务器 %s 失败: %w", srv.Name, err)
+		}
+		for _, tag := range srv.Tags {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (server_id, tag) VALUES (?, ?)`, srv.ID, tag); err != nil {
+				return err
+			}
+		}
+	}
+	rest := *cfg
+	rest.Servers = nil
+	meta, err := json.Marshal(rest)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('config', ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, string(meta)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addHistory 以当前时间记录一条历史版本
+func (s *sqliteStore) addHistory(tx *sql.Tx, data []byte, servers int) error {
+	name := newBackupName(func(name string) bool {
+		var n int
+		_ = tx.QueryRow(`SELECT COUNT(*) FROM history WHERE name = ?`, name).Scan(&n)
+		return n > 0
+	})
+	return insertHistory(tx, name, data, servers)
+}
+
+// insertHistory 写入（或替换）指定名称的历史版本，并删除超出 MaxBackups 的最旧记录
+func insertHistory(tx *sql.Tx, name string, data []byte, servers int) error {
+	t, _ := backupTime(name)
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO history (name, time, servers, data) VALUES (?, ?, ?, ?)`,
+		name, t.Format(time.RFC3339Nano), servers, string(data)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM history WHERE name NOT IN (SELECT name FROM history ORDER BY name DESC LIMIT ?)`, MaxBackups)
+	return err
+}
+
+func (s *sqliteStore) AddBackup(name string, cfg *models.Config) error {
+	if !validBackupName(name) {
+		return fmt.Errorf("无效的快照名称: %s", name)
+	}
+	if MaxBackups <= 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertHistory(tx, name, data, len(cfg.Servers)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Backups() ([]Backup, error) {
+	rows, err := s.db.Query(`SELECT name, servers, length(data) FROM history ORDER BY name DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Backup{}
+	for rows.Next() {
+		var b Backup
+		if err := rows.Scan(&b.Name, &b.Servers, &b.Size); err != nil {
+			return nil, err
+		}
+		b.Time, _ = backupTime(b.Name)
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) LoadBackup(name string) (*models.Config, error) {
+	if !validBackupName(name) {
+		return nil, fmt.Errorf("无效的快照名称: %s", name)
+	}
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM history WHERE name = ?`, name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("快照不存在: %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg models.Config
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, fmt.Errorf("解析快照失败: %w", err)
+	}
+	normalize(&cfg)
+	return &cfg, nil
+}
+
+func (s *sqliteStore) AddEvent(e Event) error {
+	_, err := s.db.Exec(`INSERT INTO audit_events (time, action, server_id, name, host, port, user, status, err, actor) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC().Format(time.RFC3339Nano), e.Action, e.ServerID, e.Name, e.Host, e.Port, e.User, e.Status, e.Err, e.Actor)
+	return err
+}
+
+func (s *sqliteStore) Events(serverID string, limit int) ([]Event, error) {
+	query := `SELECT time, action, server_id, name, host, port, user, status, err, actor FROM audit_events`
+	var args []interface{}
+	if serverID != "" {
+		query += ` WHERE server_id = ?`
+		args = append(args, serverID)
+	}
+	query += ` ORDER BY time DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Event{}
+	for rows.Next() {
+		var e Event
+		var ts string
+		if err := rows.Scan(&ts, &e.Action, &e.ServerID, &e.Name, &e.Host, &e.Port, &e.User, &e.Status, &e.Err, &e.Actor); err != nil {
+			return nil, err
+		}
+		e.Time, _ = time.Parse(time.RFC3339Nano, ts)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,662 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"lwshell/internal/models"
+)
+
+// Ansible 连接变量与 models.Server 字段的对应关系
+const (
+	varHost       = "ansible_host"
+	varPort       = "ansible_port"
+	varUser       = "ansible_user"
+	varKeyFile    = "ansible_ssh_private_key_file"
+	varPassword   = "ansible_password"
+	varSSHPass    = "ansible_ssh_pass"
+	varCommonArgs = "ansible_ssh_common_args"
+
+	// lwshell 自己的变量，Ansible 会忽略；用于导出后再导入时还原 Ansible 无法表达的字段
+	varGroupPath = "lwshell_group"      // 组变量：分组的完整路径（如 prod/db）
+	varProxyJump = "lwshell_proxy_jump" // 主机变量：按服务器名称引用的跳板机链
+	varName      = "lwshell_name"       // 主机变量：名称与 inventory 中的主机别名不同时的原名称
+
+	// maxInventoryHosts 一个 inventory 中主机范围最多展开的主机数（多个范围相乘后合计），防止上传的文件耗尽内存
+	maxInventoryHosts = 10000
+)
+
+// inventory INI 与 YAML 两种格式解析后的统一中间结构
+type inventory struct {
+	groups    map[string]*invGroup
+	hostOrder []string
+	hostVars  map[string]map[string]string
+	expanded  int // 已展开的主机数（含重复出现在多个组中的主机）
+}
+
+type invGroup struct {
+	hosts    []string
+	vars     map[string]string
+	children []string
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		groups:   make(map[string]*invGroup),
+		hostVars: make(map[string]map[string]string),
+	}
+}
+
+func (inv *inventory) group(name string) *invGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &invGroup{vars: make(map[string]string)}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+func (inv *inventory) addHost(group, host string, vars map[string]string) {
+	if _, ok := inv.hostVars[host]; !ok {
+		inv.hostVars[host] = make(map[string]string)
+		inv.hostOrder = append(inv.hostOrder, host)
+	}
+	for k, v := range vars {
+		inv.hostVars[host][k] = v
+	}
+	g := inv.group(group)
+	for _, h := range g.hosts {
+		if h == host {
+			return
+		}
+	}
+	g.hosts = append(g.hosts, host)
+}
+
+// ParseAnsibleINI 解析 INI 格式的 Ansible inventory（支持 [group]、[group:vars]、[group:children] 与 web[01:03] 形式的主机范围）
+func ParseAnsibleINI(r io.Reader) ([]models.Server, *Report, error) {
+	inv := newInventory()
+	report := &Report{}
+	section, kind := "ungrouped", ""
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section, kind = strings.TrimSpace(line[1:len(line)-1]), ""
+			if i := strings.Index(section, ":"); i >= 0 {
+				section, kind = section[:i], section[i+1:]
+			}
+			inv.group(section)
+			continue
+		}
+		fields := splitINIFields(line)
+		switch kind {
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				report.rowError(lineNo, "无法解析变量: "+line)
+				continue
+			}
+			inv.group(section).vars[strings.TrimSpace(k)] = unquoteINI(strings.TrimSpace(v))
+		case "children":
+			inv.group(section).children = append(inv.group(section).children, fields[0])
+			inv.group(fields[0])
+		case "":
+			vars := make(map[string]string)
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					report.rowError(lineNo, "无法解析主机变量: "+f)
+					continue
+				}
+				vars[k] = unquoteINI(v)
+			}
+			hosts, err := inv.expand(fields[0])
+			if err != nil {
+				report.rowError(lineNo, err.Error())
+				continue
+			}
+			for _, h := range hosts {
+				inv.addHost(section, h, vars)
+			}
+		default:
+			report.skip(fmt.Sprintf("第 %d 行 [%s:%s]（不支持的段类型）", lineNo, section, kind))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return inv.servers(report), report, nil
+}
+
+// yamlGroup YAML inventory 中的一个组
+type yamlGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts,omitempty"`
+	Vars     map[string]interface{}            `yaml:"vars,omitempty"`
+	Children map[string]*yamlGroup             `yaml:"children,omitempty"`
+}
+
+// ParseAnsibleYAML 解析 YAML 格式的 Ansible inventory
+func ParseAnsibleYAML(r io.Reader) ([]models.Server, *Report, error) {
+	var top map[string]*yamlGroup
+	if err := yaml.NewDecoder(r).Decode(&top); err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("解析 YAML 失败: %w", err)
+	}
+	inv := newInventory()
+	report := &Report{}
+	for _, name := range sortedKeys(top) {
+		inv.addYAMLGroup(name, top[name], report)
+	}
+	return inv.servers(report), report, nil
+}
+
+func (inv *inventory) addYAMLGroup(name string, yg *yamlGroup, report *Report) {
+	g := inv.group(name)
+	if yg == nil {
+		return
+	}
+	for k, v := range yg.Vars {
+		g.vars[k] = yamlScalar(v)
+	}
+	for _, h := range sortedKeys(yg.Hosts) {
+		vars := make(map[string]string)
+		for k, v := range yg.Hosts[h] {
+			vars[k] = yamlScalar(v)
+		}
+		hosts, err := inv.expand(h)
+		if err != nil {
+			report.skip(err.Error())
+			continue
+		}
+		for _, host := range hosts {
+			inv.addHost(name, host, vars)
+		}
+	}
+	for _, child := range sortedKeys(yg.Children) {
+		g.children = append(g.children, child)
+		inv.addYAMLGroup(child, yg.Children[child], report)
+	}
+}
+
+// servers 为每台主机求出最终变量（all 组 < 祖先组 < 所在组 < 主机变量）并映射为 models.Server；
+// Group 优先取 lwshell_group 变量，否则取层级最深的所在组，按 children 关系还原为 / 分隔的路径
+func (inv *inventory) servers(report *Report) []models.Server {
+	parents := make(map[string][]string)
+	for name, g := range inv.groups {
+		for _, c := range g.children {
+			parents[c] = append(parents[c], name)
+		}
+	}
+	direct := make(map[string][]string)
+	groupNames := make([]string, 0, len(inv.groups))
+	for name := range inv.groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		for _, h := range inv.groups[name].hosts {
+			direct[h] = append(direct[h], name)
+		}
+	}
+
+	out := []models.Server{}
+	for _, host := range inv.hostOrder {
+		vars := make(map[string]string)
+		if g, ok := inv.groups["all"]; ok {
+			mergeVars(vars, g.vars)
+		}
+		leaf, depth := "", -1
+		for _, gname := range direct[host] {
+			anc := ancestors(gname, parents)
+			for _, a := range anc {
+				mergeVars(vars, inv.groups[a].vars)
+			}
+			mergeVars(vars, inv.groups[gname].vars)
+			if gname != "all" && gname != "ungrouped" && len(anc) > depth {
+				leaf, depth = gname, len(anc)
+			}
+		}
+		mergeVars(vars, inv.hostVars[host])
+		group := vars[varGroupPath]
+		if group == "" && leaf != "" {
+			group = groupPath(leaf, parents)
+		}
+		s, err := serverFromVars(host, group, vars, report)
+		if err != nil {
+			report.skip(fmt.Sprintf("%s: %v", host, err))
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// ancestors 返回组的所有祖先（由远及近），忽略循环引用
+func ancestors(group string, parents map[string][]string) []string {
+	var out []string
+	seen := map[string]bool{group: true}
+	var walk func(g string)
+	walk = func(g string) {
+		for _, p := range parents[g] {
+			if seen[p] || p == "all" {
+				continue
+			}
+			seen[p] = true
+			walk(p)
+			out = append(out, p)
+		}
+	}
+	walk(group)
+	return out
+}
+
+// groupPath 沿 children 关系向上（多个父组时取名称最小的）拼出 / 分隔的分组路径；
+// 子组名以「父组名_」开头时去掉该前缀（lwshell 导出的组名即为此形式）
+func groupPath(group string, parents map[string][]string) string {
+	var segs []string
+	seen := make(map[string]bool)
+	for cur := group; cur != "" && !seen[cur]; {
+		seen[cur] = true
+		parent := ""
+		for _, p := range parents[cur] {
+			if p != "all" && (parent == "" || p < parent) {
+				parent = p
+			}
+		}
+		seg := cur
+		if parent != "" && strings.HasPrefix(cur, parent+"_") {
+			seg = cur[len(parent)+1:]
+		}
+		segs = append([]string{seg}, segs...)
+		cur = parent
+	}
+	return strings.Join(segs, "/")
+}
+
+func mergeVars(dst, src map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+var proxyJumpArg = regexp.MustCompile(`(?:-J\s*|ProxyJump[=\s]+)([^\s'"]+)`)
+
+func serverFromVars(host, group string, vars map[string]string, report *Report) (models.Server, error) {
+	s := models.Server{Name: host, Host: host, Port: 22, Group: group}
+	for k, v := range vars {
+		switch k {
+		case varHost:
+			s.Host = v
+		case varPort:
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 65535 {
+				return s, fmt.Errorf("ansible_port 无效: %q", v)
+			}
+			s.Port = n
+		case varUser:
+			s.User = v
+		case varKeyFile:
+			s.KeyPath = expandHome(v)
+		case varPassword, varSSHPass:
+			s.Password = v
+		case varCommonArgs:
+			if m := proxyJumpArg.FindStringSubmatch(v); m != nil {
+				s.ProxyJump = m[1]
+			} else {
+				report.unsupported(k)
+			}
+		case varGroupPath:
+		case varProxyJump, varName:
+			// 在循环后处理，优先于 ansible_host 与 ansible_ssh_common_args
+		default:
+			report.unsupported(k)
+		}
+	}
+	if v := vars[varProxyJump]; v != "" {
+		s.ProxyJump = v
+	}
+	if v := vars[varName]; v != "" {
+		s.Name = v
+	}
+	if s.User == "" {
+		return s, fmt.Errorf("缺少 ansible_user")
+	}
+	return s, nil
+}
+
+// WriteAnsibleINI 将服务器列表写为 INI 格式的 Ansible inventory（不含密码）
+func WriteAnsibleINI(w io.Writer, servers []models.Server) error {
+	names := SSHAliases(servers)
+	tree := ansibleGroups(servers)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Generated by lwshell. Passwords are not exported.")
+	for _, name := range tree.order {
+		g := tree.groups[name]
+		if len(g.hosts) > 0 || g.path == "" {
+			fmt.Fprintf(bw, "\n[%s]\n", name)
+			for _, i := range g.hosts {
+				fmt.Fprint(bw, names[i])
+				for _, kv := range ansibleVars(servers[i], names[i], servers) {
+					fmt.Fprintf(bw, " %s=%s", kv[0], quoteINI(kv[1]))
+				}
+				fmt.Fprintln(bw)
+			}
+		}
+		if len(g.children) > 0 {
+			fmt.Fprintf(bw, "\n[%s:children]\n", name)
+			for _, c := range g.children {
+				fmt.Fprintln(bw, c)
+			}
+		}
+		if g.path != "" {
+			fmt.Fprintf(bw, "\n[%s:vars]\n%s=%s\n", name, varGroupPath, quoteINI(g.path))
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteAnsibleYAML 将服务器列表写为 YAML 格式的 Ansible inventory（不含密码）
+func WriteAnsibleYAML(w io.Writer, servers []models.Server) error {
+	names := SSHAliases(servers)
+	tree := ansibleGroups(servers)
+	var build func(name string) *yamlGroup
+	build = func(name string) *yamlGroup {
+		g := tree.groups[name]
+		yg := &yamlGroup{}
+		if len(g.hosts) > 0 {
+			yg.Hosts = make(map[string]map[string]interface{})
+		}
+		for _, i := range g.hosts {
+			vars := make(map[string]interface{})
+			for _, kv := range ansibleVars(servers[i], names[i], servers) {
+				if kv[0] == varPort {
+					n, _ := strconv.Atoi(kv[1])
+					vars[kv[0]] = n
+					continue
+				}
+				vars[kv[0]] = kv[1]
+			}
+			yg.Hosts[names[i]] = vars
+		}
+		if g.path != "" {
+			yg.Vars = map[string]interface{}{varGroupPath: g.path}
+		}
+		if len(g.children) > 0 {
+			yg.Children = make(map[string]*yamlGroup)
+			for _, c := range g.children {
+				yg.Children[c] = build(c)
+			}
+		}
+		return yg
+	}
+	all := &yamlGroup{Children: make(map[string]*yamlGroup)}
+	for _, name := range tree.top {
+		if name == "ungrouped" {
+			all.Hosts = build(name).Hosts
+			continue
+		}
+		all.Children[name] = build(name)
+	}
+	if _, err := io.WriteString(w, "# Generated by lwshell. Passwords are not exported.\n"); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]*yamlGroup{"all": all}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+var ansibleGroupUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// ansibleGroup 导出时的一个组：path 为对应的分组路径（ungrouped 为空），hosts 为直接属于该组的服务器下标
+type ansibleGroup struct {
+	path     string
+	hosts    []int
+	children []string
+}
+
+// ansibleTree 按分组路径生成的组层级；order 为全部组名（排序），top 为顶层组名
+type ansibleTree struct {
+	groups map[string]*ansibleGroup
+	order  []string
+	top    []string
+}
+
+// ansibleGroups 为分组路径的每一级生成一个组（prod/db 对应组 prod 与其子组 prod_db），组名转换为 Ansible 合法的标识符，
+// 全局重名时追加序号；服务器放入最深一级的组，未分组的主机放入 ungrouped
+func ansibleGroups(servers []models.Server) *ansibleTree {
+	t := &ansibleTree{groups: make(map[string]*ansibleGroup)}
+	byPath := make(map[string]string)
+	var name func(path string) string
+	name = func(path string) string {
+		if n, ok := byPath[path]; ok {
+			return n
+		}
+		parent, base := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent, base = name(path[:i]), path[i+1:]
+		}
+		seg := strings.Trim(ansibleGroupUnsafe.ReplaceAllString(base, "_"), "_")
+		if seg == "" {
+			seg = "group"
+		}
+		n := seg
+		if parent != "" {
+			n = parent + "_" + seg
+		}
+		for i, base := 2, n; t.groups[n] != nil || n == "all" || n == "ungrouped"; i++ {
+			n = fmt.Sprintf("%s_%d", base, i)
+		}
+		byPath[path] = n
+		t.groups[n] = &ansibleGroup{path: path}
+		if parent != "" {
+			t.groups[parent].children = append(t.groups[parent].children, n)
+		} else {
+			t.top = append(t.top, n)
+		}
+		return n
+	}
+	for i, s := range servers {
+		path := strings.Trim(s.Group, "/")
+		if path == "" {
+			if t.groups["ungrouped"] == nil {
+				t.groups["ungrouped"] = &ansibleGroup{}
+				t.top = append(t.top, "ungrouped")
+			}
+			t.groups["ungrouped"].hosts = append(t.groups["ungrouped"].hosts, i)
+			continue
+		}
+		g := t.groups[name(path)]
+		g.hosts = append(g.hosts, i)
+	}
+	for n, g := range t.groups {
+		t.order = append(t.order, n)
+		sort.Strings(g.children)
+	}
+	sort.Strings(t.order)
+	sort.Strings(t.top)
+	return t
+}
+
+// ansibleVars 生成主机变量；ProxyJump 中引用其他服务器名称的跳会展开为 user@host:port 供 Ansible 使用，
+// 原始的名称引用另存为 lwshell_proxy_jump，再次导入时还原
+func ansibleVars(s models.Server, alias string, servers []models.Server) [][2]string {
+	port := s.Port
+	if port <= 0 {
+		port = 22
+	}
+	vars := [][2]string{
+		{varHost, s.Host},
+		{varPort, strconv.Itoa(port)},
+		{varUser, s.User},
+	}
+	if s.Name != alias {
+		vars = append(vars, [2]string{varName, s.Name})
+	}
+	if s.KeyPath != "" {
+		vars = append(vars, [2]string{varKeyFile, s.KeyPath})
+	}
+	if s.ProxyJump != "" {
+		var hops []string
+		named := false
+		for _, hop := range strings.Split(s.ProxyJump, ",") {
+			hop = strings.TrimSpace(hop)
+			for _, js := range servers {
+				if js.Name == hop {
+					jp := js.Port
+					if jp <= 0 {
+						jp = 22
+					}
+					hop, named = js.User+"@"+net.JoinHostPort(js.Host, strconv.Itoa(jp)), true
+					break
+				}
+			}
+			if hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+		vars = append(vars, [2]string{varCommonArgs, "-o ProxyJump=" + strings.Join(hops, ",")})
+		if named {
+			vars = append(vars, [2]string{varProxyJump, s.ProxyJump})
+		}
+	}
+	return vars
+}
+
+var hostRange = regexp.MustCompile(`\[(\d+):(\d+)\]`)
+
+// expand 展开主机范围，并累计到整个 inventory 的上限中
+func (inv *inventory) expand(pattern string) ([]string, error) {
+	n, err := hostRangeCount(pattern, maxInventoryHosts-inv.expanded)
+	if err != nil {
+		return nil, err
+	}
+	inv.expanded += n
+	return expandHostRange(pattern)
+}
+
+// hostRangeCount 计算 pattern 展开后的主机数；超过 limit 时返回错误（不实际展开）
+func hostRangeCount(pattern string, limit int) (int, error) {
+	total := 1
+	for _, m := range hostRange.FindAllStringSubmatch(pattern, -1) {
+		a, _ := strconv.Atoi(m[1])
+		b, _ := strconv.Atoi(m[2])
+		if b < a || b-a > 1000 {
+			return 0, fmt.Errorf("主机范围无效: %s", pattern)
+		}
+		total *= b - a + 1
+		if total > limit {
+			return 0, fmt.Errorf("主机范围展开后超过 %d 台: %s", maxInventoryHosts, pattern)
+		}
+	}
+	return total, nil
+}
+
+// expandHostRange 展开 web[01:03].example.com 形式的数字范围（保留前导零宽度）；调用前须先用 hostRangeCount 检查数量
+func expandHostRange(pattern string) ([]string, error) {
+	m := hostRange.FindStringSubmatchIndex(pattern)
+	if m == nil {
+		return []string{pattern}, nil
+	}
+	from, to := pattern[m[2]:m[3]], pattern[m[4]:m[5]]
+	a, _ := strconv.Atoi(from)
+	b, _ := strconv.Atoi(to)
+	if b < a || b-a > 1000 {
+		return nil, fmt.Errorf("主机范围无效: %s", pattern)
+	}
+	width := 0
+	if strings.HasPrefix(from, "0") && len(from) > 1 {
+		width = len(from)
+	}
+	var out []string
+	for n := a; n <= b; n++ {
+		rest, err := expandHostRange(pattern[m[1]:])
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			out = append(out, fmt.Sprintf("%s%0*d%s", pattern[:m[0]], width, n, r))
+		}
+	}
+	return out, nil
+}
+
+// splitINIFields 按空白拆分，保留引号内的空白
+func splitINIFields(line string) []string {
+	var out []string
+	var cur strings.Builder
+	var quote rune
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			cur.WriteRune(c)
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			cur.WriteRune(c)
+		case c == ' ' || c == '\t':
+			if cur.Len() > 0 {
+				out = append(out, cur.String())
+				cur.Reset()
+			}
+		case c == '#' && cur.Len() == 0:
+			return out
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if cur.Len() > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
+
+func unquoteINI(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+func quoteINI(v string) string {
+	if !strings.ContainsAny(v, " \t#'\"") {
+		return v
+	}
+	if strings.Contains(v, `"`) {
+		return "'" + v + "'"
+	}
+	return `"` + v + `"`
+}
+
+func yamlScalar(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
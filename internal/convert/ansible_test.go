@@ -0,0 +1,72 @@
+package convert
+
+import (
+	"bytes"
+	"testing"
+
+	"lwshell/internal/models"
+)
+
+func TestAnsibleRoundTrip(t *testing.T) {
+	servers := []models.Server{
+		{Name: "bastion", Host: "203.0.113.1", Port: 22, User: "jump", Group: "生产"},
+		{Name: "db 1", Host: "10.0.0.5", Port: 2222, User: "postgres", Group: "生产/db/primary", KeyPath: "/keys/db", ProxyJump: "bastion"},
+		{Name: "web", Host: "10.0.0.6", Port: 22, User: "deploy", Group: "prod/web", ProxyJump: "bastion,admin@198.51.100.7:2200"},
+		{Name: "prod_web", Host: "10.0.0.7", Port: 22, User: "deploy", Group: "prod_web"},
+		{Name: "laptop", Host: "192.168.1.2", Port: 22, User: "me"},
+	}
+	formats := []struct {
+		name  string
+		write func(*bytes.Buffer, []models.Server) error
+		parse func(*bytes.Buffer) ([]models.Server, *Report, error)
+	}{
+		{"ini",
+			func(b *bytes.Buffer, s []models.Server) error { return WriteAnsibleINI(b, s) },
+			func(b *bytes.Buffer) ([]models.Server, *Report, error) { return ParseAnsibleINI(b) }},
+		{"yaml",
+			func(b *bytes.Buffer, s []models.Server) error { return WriteAnsibleYAML(b, s) },
+			func(b *bytes.Buffer) ([]models.Server, *Report, error) { return ParseAnsibleYAML(b) }},
+	}
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := f.write(&buf, servers); err != nil {
+				t.Fatal(err)
+			}
+			text := buf.String()
+			got, report, err := f.parse(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Unsupported) > 0 || len(report.Skipped) > 0 {
+				t.Fatalf("report %+v\n%s", report, text)
+			}
+			byName := make(map[string]models.Server)
+			for _, s := range got {
+				byName[s.Name] = s
+			}
+			for _, want := range servers {
+				s, ok := byName[want.Name]
+				if !ok {
+					t.Fatalf("%s missing after round trip\n%s", want.Name, text)
+				}
+				if s.Group != want.Group || s.Host != want.Host || s.Port != want.Port || s.User != want.User ||
+					s.KeyPath != want.KeyPath || s.ProxyJump != want.ProxyJump {
+					t.Fatalf("round trip changed %s:\n got %+v\nwant %+v\n%s", want.Name, s, want, text)
+				}
+			}
+		})
+	}
+}
+
+// TestAnsibleChildrenGroupPath 其他工具生成的 inventory（无 lwshell_group）按 children 关系还原分组路径
+func TestAnsibleChildrenGroupPath(t *testing.T) {
+	inv := "[prod:children]\nprod_db\n\n[prod_db]\ndb1 ansible_user=root\n\n[monitored]\ndb1\n"
+	got, _, err := ParseAnsibleINI(bytes.NewBufferString(inv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Group != "prod/db" {
+		t.Fatalf("got %+v, want group prod/db", got)
+	}
+}
@@ -0,0 +1,132 @@
+package convert
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/models"
+)
+
+// csvColumns 导出时的列顺序（与 models.Server 的 json 字段名一致）；导出不含 password 列，tags 列中多个标签以 ; 分隔
+var csvColumns = []string{"id", "name", "host", "port", "user", "key_path", "group", "proxy_jump", "tags"}
+
+// csvTagSep tags 列中的标签分隔符
+const csvTagSep = ";"
+
+// WriteCSV 将服务器列表写为带表头的 CSV（不含密码）
+func WriteCSV(w io.Writer, servers []models.Server) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, s := range servers {
+		port := s.Port
+		if port <= 0 {
+			port = 22
+		}
+		row := []string{s.ID, s.Name, s.Host, strconv.Itoa(port), s.User, s.KeyPath, s.Group, s.ProxyJump, strings.Join(s.Tags, csvTagSep)}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ParseCSV 解析带表头的 CSV：表头按 models.Server 的 json 字段名（不区分大小写）映射，可额外包含 password 列。
+// 每行单独校验（name、host、user 必填，端口 1-65535，留空为 22），校验失败的行记录到 Report.Errors 并跳过，不影响其余行
+func ParseCSV(r io.Reader) ([]models.Server, *Report, error) {
+	report := &Report{}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return []models.Server{}, report, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取 CSV 表头失败: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		switch h {
+		case "id", "name", "host", "port", "user", "password", "key_path", "group", "proxy_jump", "tags":
+			cols[h] = i
+		default:
+			if h != "" {
+				report.unsupported(h)
+			}
+		}
+	}
+	for _, required := range []string{"name", "host", "user"} {
+		if _, ok := cols[required]; !ok {
+			return nil, nil, fmt.Errorf("CSV 表头缺少 %s 列", required)
+		}
+	}
+
+	servers := []models.Server{}
+	row := 1
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			report.rowError(row, err.Error())
+			continue
+		}
+		get := func(col string) string {
+			i, ok := cols[col]
+			if !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		if strings.TrimSpace(strings.Join(rec, "")) == "" {
+			continue // 空行
+		}
+		s := models.Server{
+			ID:        get("id"),
+			Name:      get("name"),
+			Host:      get("host"),
+			User:      get("user"),
+			Password:  get("password"),
+			KeyPath:   get("key_path"),
+			Group:     get("group"),
+			ProxyJump: get("proxy_jump"),
+			Port:      22,
+		}
+		if tags := get("tags"); tags != "" {
+			s.Tags = strings.Split(tags, csvTagSep)
+		}
+		var missing []string
+		if s.Name == "" {
+			missing = append(missing, "name")
+		}
+		if s.Host == "" {
+			missing = append(missing, "host")
+		}
+		if s.User == "" {
+			missing = append(missing, "user")
+		}
+		if len(missing) > 0 {
+			report.rowError(row, "缺少必填字段: "+strings.Join(missing, ", "))
+			continue
+		}
+		if p := get("port"); p != "" {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 1 || n > 65535 {
+				report.rowError(row, fmt.Sprintf("端口无效: %q（应为 1-65535）", p))
+				continue
+			}
+			s.Port = n
+		}
+		servers = append(servers, s)
+	}
+	return servers, report, nil
+}
@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/models"
+)
+
+// MobaXterm 会话字符串中的字段位置（以 % 分隔，第 0 段为「#类型#图标」）
+const (
+	mobaSSHType     = "109"
+	mobaHost        = 1
+	mobaPort        = 2
+	mobaUser        = 3
+	mobaCommand     = 7
+	mobaGatewayHost = 8
+	mobaGatewayPort = 9
+	mobaGatewayUser = 10
+	mobaKey         = 14
+)
+
+// ParseMobaXterm 解析 MobaXterm 导出的 .mxtsessions：每个 [Bookmarks*] 段的 SubRep 为目录（映射为分组），
+// 其余键为「会话名=#109#...」形式的会话；仅导入 SSH（类型 109）会话，SSH 网关映射为 ProxyJump
+func ParseMobaXterm(content string) ([]models.Server, *Report, error) {
+	report := &Report{}
+	servers := []models.Server{}
+	home, _ := os.UserHomeDir()
+	group := ""
+	inBookmarks := false
+	sc := bufio.NewScanner(strings.NewReader(content))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inBookmarks = strings.HasPrefix(line, "[Bookmarks")
+			group = ""
+			continue
+		}
+		if !inBookmarks {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "SubRep":
+			group = strings.ReplaceAll(mobaUnescape(v), `\`, "/")
+			continue
+		case "ImgNum":
+			continue
+		}
+		if !strings.HasPrefix(v, "#") {
+			continue
+		}
+		conn := v
+		if i := strings.Index(v[1:], "#"); i >= 0 {
+			if typ := v[1 : i+1]; typ != mobaSSHType {
+				report.skip(k + "（非 SSH 会话，类型 " + typ + "）")
+				continue
+			}
+		}
+		// 会话定义后跟 #MobaFont... 等终端外观设置，只取第一段
+		if i := strings.Index(conn, "#MobaFont"); i >= 0 {
+			conn = conn[:i]
+		}
+		parts := strings.Split(conn, "%")
+		field := func(i int) string {
+			if i >= len(parts) {
+				return ""
+			}
+			return mobaUnescape(parts[i])
+		}
+		s := models.Server{Name: k, Host: field(mobaHost), User: field(mobaUser), Port: 22, Group: group}
+		if n, err := strconv.Atoi(field(mobaPort)); err == nil && n > 0 {
+			s.Port = n
+		}
+		if key := field(mobaKey); key != "" {
+			// _ProfileDir_ 为 MobaXterm 所在用户目录，换成本机主目录
+			if rest, ok := strings.CutPrefix(key, "_ProfileDir_"); ok {
+				key = filepath.Join(home, filepath.FromSlash(strings.ReplaceAll(rest, `\`, "/")))
+			}
+			s.KeyPath = key
+			if strings.HasSuffix(strings.ToLower(key), ".ppk") {
+				report.unsupported("私钥（.ppk 需转换为 OpenSSH 格式）")
+			}
+		}
+		if gw := field(mobaGatewayHost); gw != "" {
+			hop := gw
+			if u := field(mobaGatewayUser); u != "" {
+				hop = u + "@" + hop
+			}
+			if p := field(mobaGatewayPort); p != "" && p != "22" {
+				hop += ":" + p
+			}
+			s.ProxyJump = hop
+		}
+		if field(mobaCommand) != "" {
+			report.unsupported("执行命令（Execute command）")
+		}
+		if s.Host == "" {
+			report.skip(k + "（缺少主机）")
+			continue
+		}
+		if s.User == "" {
+			report.skip(k + "（缺少用户名）")
+			continue
+		}
+		servers = append(servers, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return servers, report, nil
+}
+
+// mobaUnescape 还原 MobaXterm 对特殊字符与路径的转义
+func mobaUnescape(v string) string {
+	r := strings.NewReplacer(
+		"__PTVIRG__", ";",
+		"__DIEZE__", "#",
+		"__PIPE__", "|",
+		"__DBLQUO__", `"`,
+		"__APOSTROPHE__", "'",
+		"__PERCENT__", "%",
+	)
+	return r.Replace(v)
+}
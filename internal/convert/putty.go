@@ -0,0 +1,129 @@
+package convert
+
+import (
+	"bufio"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/models"
+)
+
+// puttySessionsKey PuTTY 会话在注册表中的路径（KiTTY 等衍生版本路径不同，按包含 \Sessions\ 识别）
+const puttySessionsKey = `\Sessions\`
+
+// ParsePuTTYReg 解析 PuTTY 的注册表导出文件（regedit 导出的 .reg）：
+// 每个 Sessions 子键为一个会话，映射 HostName、PortNumber、UserName、PublicKeyFile，
+// KiTTY 的 Folder 值或会话名中的「目录/名称」映射为分组；非 SSH 协议的会话跳过
+func ParsePuTTYReg(content string) ([]models.Server, *Report, error) {
+	report := &Report{}
+	type session struct {
+		name string
+		vals map[string]string
+	}
+	var sessions []*session
+	var cur *session
+	sc := bufio.NewScanner(strings.NewReader(content))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			cur = nil
+			key := line[1 : len(line)-1]
+			i := strings.LastIndex(key, puttySessionsKey)
+			if i < 0 || strings.HasPrefix(key, "-") {
+				continue
+			}
+			name, err := url.PathUnescape(key[i+len(puttySessionsKey):])
+			if err != nil {
+				name = key[i+len(puttySessionsKey):]
+			}
+			if name == "" || strings.Contains(name, `\`) {
+				continue // 会话下的子键（如 SshHostKeys）
+			}
+			cur = &session{name: name, vals: make(map[string]string)}
+			sessions = append(sessions, cur)
+			continue
+		}
+		if cur == nil || !strings.HasPrefix(line, `"`) {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		cur.vals[strings.Trim(k, `"`)] = regValue(v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	servers := []models.Server{}
+	for _, s := range sessions {
+		if s.name == "Default Settings" {
+			continue
+		}
+		if p := s.vals["Protocol"]; p != "" && p != "ssh" {
+			report.skip(s.name + "（协议 " + p + "，仅支持 SSH）")
+			continue
+		}
+		host := s.vals["HostName"]
+		if host == "" {
+			report.skip(s.name + "（缺少 HostName）")
+			continue
+		}
+		srv := models.Server{Name: s.name, Host: host, Port: 22, User: s.vals["UserName"]}
+		if u, h, ok := strings.Cut(host, "@"); ok {
+			if srv.User == "" {
+				srv.User = u
+			}
+			srv.Host = h
+		}
+		if n, err := strconv.Atoi(s.vals["PortNumber"]); err == nil && n > 0 {
+			srv.Port = n
+		}
+		if k := s.vals["PublicKeyFile"]; k != "" {
+			srv.KeyPath = k
+			if strings.HasSuffix(strings.ToLower(k), ".ppk") {
+				report.unsupported("PublicKeyFile（.ppk 私钥需用 puttygen 转换为 OpenSSH 格式）")
+			}
+		}
+		if f := s.vals["Folder"]; f != "" {
+			srv.Group = strings.ReplaceAll(f, `\`, "/")
+		} else if i := strings.LastIndex(srv.Name, "/"); i > 0 {
+			srv.Group, srv.Name = srv.Name[:i], srv.Name[i+1:]
+		}
+		if s.vals["ProxyMethod"] != "" && s.vals["ProxyMethod"] != "0" {
+			report.unsupported("ProxyMethod / ProxyHost（PuTTY 代理设置）")
+		}
+		if s.vals["PortForwardings"] != "" {
+			report.unsupported("PortForwardings（端口转发）")
+		}
+		if s.vals["RemoteCommand"] != "" {
+			report.unsupported("RemoteCommand（远程命令）")
+		}
+		if srv.User == "" {
+			report.skip(s.name + "（缺少 UserName）")
+			continue
+		}
+		servers = append(servers, srv)
+	}
+	return servers, report, nil
+}
+
+// regValue 解析 .reg 中的值："字符串"（\\ 与 \" 转义）或 dword:十六进制
+func regValue(v string) string {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "dword:") {
+		n, err := strconv.ParseUint(strings.TrimPrefix(v, "dword:"), 16, 32)
+		if err != nil {
+			return ""
+		}
+		return strconv.FormatUint(n, 10)
+	}
+	if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+		v = v[1 : len(v)-1]
+		return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(v)
+	}
+	return v
+}
@@ -0,0 +1,32 @@
+package convert
+
+// Report 转换过程中被跳过或无法映射的内容，随导入预览一起返回给前端
+type Report struct {
+	Skipped     []string   `json:"skipped,omitempty"`     // 被跳过的条目及原因
+	Unsupported []string   `json:"unsupported,omitempty"` // 源格式中存在但 lwshell 不支持的字段
+	Errors      []RowError `json:"errors,omitempty"`      // 校验失败、未导入的行
+}
+
+// RowError 某一行（或条目）的校验错误，Row 从 1 开始计数（含表头）
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+func (r *Report) skip(msg string) {
+	r.Skipped = append(r.Skipped, msg)
+}
+
+func (r *Report) rowError(row int, msg string) {
+	r.Errors = append(r.Errors, RowError{Row: row, Error: msg})
+}
+
+// unsupported 记录不支持的字段（去重）
+func (r *Report) unsupported(field string) {
+	for _, f := range r.Unsupported {
+		if f == field {
+			return
+		}
+	}
+	r.Unsupported = append(r.Unsupported, field)
+}
@@ -0,0 +1,322 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/models"
+)
+
+// maxIncludeDepth Include 最大嵌套层数，与 OpenSSH 一致，防止循环引用
+const maxIncludeDepth = 16
+
+// sshBlock 一个 Host 段（文件开头、第一个 Host 之前的全局选项视为 Host *）
+type sshBlock struct {
+	patterns []string
+	match    bool // Match 段：条件无法静态求值，整段跳过
+	opts     []sshOpt
+}
+
+type sshOpt struct {
+	key   string // 小写关键字
+	value string
+}
+
+type sshParser struct {
+	sshDir    string
+	blocks    []*sshBlock
+	current   *sshBlock
+	report    *Report
+	noInclude bool // 不展开 Include（解析上传内容时）
+}
+
+// ParseSSHConfig 解析 OpenSSH 客户端配置文件，支持 Include、Host 通配符、HostName、User、Port、IdentityFile、ProxyJump；
+// path 为空时读取 ~/.ssh/config
+func ParseSSHConfig(p string) ([]models.Server, *Report, error) {
+	sp, err := newSSHParser()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p == "" {
+		p = filepath.Join(sp.sshDir, "config")
+	}
+	if err := sp.parseFile(expandHome(p), 0); err != nil {
+		return nil, nil, err
+	}
+	return sp.servers(), sp.report, nil
+}
+
+// ParseSSHConfigContent 解析 ssh_config 文本内容（如浏览器上传的文件）。其中的 Include 不展开、记入 report.skipped：
+// 否则上传者可借 Include 读取本机任意文件，并从不支持的字段列表中看到文件内容
+func ParseSSHConfigContent(content string) ([]models.Server, *Report, error) {
+	sp, err := newSSHParser()
+	if err != nil {
+		return nil, nil, err
+	}
+	sp.noInclude = true
+	if err := sp.parseText(content, "(上传内容)", 0); err != nil {
+		return nil, nil, err
+	}
+	return sp.servers(), sp.report, nil
+}
+
+func newSSHParser() (*sshParser, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	global := &sshBlock{patterns: []string{"*"}}
+	return &sshParser{
+		sshDir:  filepath.Join(home, ".ssh"),
+		blocks:  []*sshBlock{global},
+		current: global,
+		report:  &Report{},
+	}, nil
+}
+
+func (sp *sshParser) parseFile(p string, depth int) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", p, err)
+	}
+	return sp.parseText(string(data), p, depth)
+}
+
+func (sp *sshParser) parseText(text, source string, depth int) error {
+	sc := bufio.NewScanner(strings.NewReader(text))
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, args := splitSSHLine(line)
+		if key == "" {
+			continue
+		}
+		lower := strings.ToLower(key)
+		switch lower {
+		case "host":
+			sp.current = &sshBlock{patterns: args}
+			sp.blocks = append(sp.blocks, sp.current)
+		case "match":
+			sp.current = &sshBlock{match: true}
+			sp.blocks = append(sp.blocks, sp.current)
+			sp.report.skip(fmt.Sprintf("%s:%d Match %s（不支持 Match 条件，已跳过整段）", source, lineNo, strings.Join(args, " ")))
+		case "include":
+			if sp.noInclude {
+				sp.report.skip(fmt.Sprintf("%s:%d Include %s（上传内容不读取本机文件，已跳过）", source, lineNo, strings.Join(args, " ")))
+				continue
+			}
+			if depth+1 > maxIncludeDepth {
+				return fmt.Errorf("%s:%d Include 嵌套过深", source, lineNo)
+			}
+			for _, pattern := range args {
+				if err := sp.include(pattern, depth+1); err != nil {
+					return err
+				}
+			}
+		case "hostname", "user", "port", "identityfile", "proxyjump":
+			if len(args) == 0 {
+				continue
+			}
+			sp.current.opts = append(sp.current.opts, sshOpt{key: lower, value: strings.Join(args, " ")})
+		default:
+			sp.report.unsupported(key)
+		}
+	}
+	return sc.Err()
+}
+
+// include 展开 Include 的 glob，相对路径基于 ~/.ssh（与 OpenSSH 对用户配置的处理一致）
+func (sp *sshParser) include(pattern string, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(sp.sshDir, pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("Include %s: %w", pattern, err)
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		if err := sp.parseFile(m, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// servers 为每个具体的 Host 别名（不含通配符）按 OpenSSH「先出现者优先」的规则求出最终配置
+func (sp *sshParser) servers() []models.Server {
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	seen := make(map[string]bool)
+	out := []models.Server{}
+	for _, b := range sp.blocks {
+		if b.match {
+			continue
+		}
+		for _, alias := range b.patterns {
+			if seen[alias] {
+				continue
+			}
+			if strings.ContainsAny(alias, "*?!") {
+				continue
+			}
+			seen[alias] = true
+			s, ok := sp.resolve(alias, localUser)
+			if ok {
+				out = append(out, s)
+			}
+		}
+	}
+	// 第一个块为隐式的全局 Host *，不计入
+	for _, b := range sp.blocks[1:] {
+		if b.match {
+			continue
+		}
+		concrete := false
+		for _, p := range b.patterns {
+			if !strings.ContainsAny(p, "*?!") {
+				concrete = true
+			}
+		}
+		if !concrete {
+			sp.report.skip("Host " + strings.Join(b.patterns, " ") + "（通配符，仅作为默认值应用到匹配的主机）")
+		}
+	}
+	return out
+}
+
+func (sp *sshParser) resolve(alias, localUser string) (models.Server, bool) {
+	vals := make(map[string]string)
+	for _, b := range sp.blocks {
+		if b.match || !hostMatches(alias, b.patterns) {
+			continue
+		}
+		for _, o := range b.opts {
+			if _, ok := vals[o.key]; !ok {
+				vals[o.key] = o.value
+			}
+		}
+	}
+	s := models.Server{
+		Name: alias,
+		Host: alias,
+		Port: 22,
+		User: localUser,
+	}
+	if v := vals["hostname"]; v != "" {
+		s.Host = expandTokens(v, alias, "", localUser)
+	}
+	if v := vals["user"]; v != "" {
+		s.User = v
+	}
+	if v := vals["port"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 65535 {
+			sp.report.skip(fmt.Sprintf("Host %s: 端口 %q 无效，已使用 22", alias, v))
+		} else {
+			s.Port = n
+		}
+	}
+	if v := vals["identityfile"]; v != "" && !strings.EqualFold(v, "none") {
+		s.KeyPath = expandHome(expandTokens(v, alias, s.User, localUser))
+	}
+	if v := vals["proxyjump"]; v != "" && !strings.EqualFold(v, "none") {
+		s.ProxyJump = v
+	}
+	if s.User == "" {
+		sp.report.skip("Host " + alias + "（缺少 User）")
+		return s, false
+	}
+	return s, true
+}
+
+// hostMatches OpenSSH 的 Host 匹配：任一正向模式命中且没有否定模式（!pattern）命中
+func hostMatches(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		neg := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		ok, _ := path.Match(p, host)
+		if !ok {
+			continue
+		}
+		if neg {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// splitSSHLine 拆分「Keyword args」或「Keyword=args」，参数支持双引号
+func splitSSHLine(line string) (string, []string) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return line, nil
+	}
+	key := line[:i]
+	rest := strings.TrimLeft(line[i:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+	var args []string
+	var cur strings.Builder
+	inQuote := false
+	has := false
+	for _, c := range rest {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			has = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if has {
+				args = append(args, cur.String())
+				cur.Reset()
+				has = false
+			}
+		default:
+			cur.WriteRune(c)
+			has = true
+		}
+	}
+	if has {
+		args = append(args, cur.String())
+	}
+	return key, args
+}
+
+// expandTokens 替换 ssh_config 中常用的 % 记号：%h 主机别名、%r 远程用户、%u 本地用户、%d 主目录、%% 百分号
+func expandTokens(s, host, remoteUser, localUser string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	home, _ := os.UserHomeDir()
+	r := strings.NewReplacer("%%", "%", "%h", host, "%r", remoteUser, "%u", localUser, "%d", home)
+	return r.Replace(s)
+}
+
+// expandHome 将开头的 ~ 展开为用户主目录
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
@@ -0,0 +1,55 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSSHConfigContentSkipsInclude(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// 本机文件中的主机与字段都不应出现在结果中
+	secret := "Host local\n  HostName 10.9.9.9\n  User root\nSECRETTOKEN value\n"
+	if err := os.WriteFile(filepath.Join(sshDir, "extra"), []byte(secret), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content := "Include /etc/*\nInclude ~/.ssh/*\nInclude extra\n\nHost web\n  HostName 10.0.0.1\n  User deploy\n"
+	servers, report, err := ParseSSHConfigContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Name != "web" {
+		t.Fatalf("got servers %+v, want only web", servers)
+	}
+	if len(report.Unsupported) != 0 {
+		t.Fatalf("unsupported fields leaked from included files: %v", report.Unsupported)
+	}
+	skipped := 0
+	for _, s := range report.Skipped {
+		if strings.Contains(s, "Include") {
+			skipped++
+		}
+	}
+	if skipped != 3 {
+		t.Fatalf("got %d skipped Include lines, want 3: %v", skipped, report.Skipped)
+	}
+
+	// 读取本机文件时仍展开 Include
+	main := filepath.Join(sshDir, "config")
+	if err := os.WriteFile(main, []byte("Include extra\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	servers, _, err = ParseSSHConfig(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Name != "local" {
+		t.Fatalf("got servers %+v from local file, want local", servers)
+	}
+}
@@ -0,0 +1,124 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"lwshell/internal/models"
+)
+
+var aliasUnsafe = regexp.MustCompile(`[\s\pC*?!,#"\\]+`)
+
+// WriteSSHConfig 将服务器列表写为 OpenSSH 配置（每台服务器一个 Host 段）。
+// Host 别名取自服务器名称；ProxyJump 中引用其他服务器名称的跳会改写为对应别名，链式跳板由 ssh 递归解析。
+// 密码永远不会写入。
+func WriteSSHConfig(w io.Writer, servers []models.Server) error {
+	aliases := SSHAliases(servers)
+	byName := make(map[string]string, len(servers))
+	for i, s := range servers {
+		if _, ok := byName[s.Name]; !ok {
+			byName[s.Name] = aliases[i]
+		}
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Generated by lwshell. Passwords are not exported.")
+	for i, s := range servers {
+		fmt.Fprintln(bw)
+		// 字段中的换行等控制字符会在配置中插入额外的指令（如 ProxyCommand），整台跳过
+		if hasControl(s.Host, s.User, s.KeyPath, s.ProxyJump) {
+			fmt.Fprintf(bw, "# skipped %s: field contains control characters\n", aliases[i])
+			continue
+		}
+		if s.Name != aliases[i] {
+			fmt.Fprintf(bw, "# %s\n", commentText(s.Name))
+		}
+		if s.Group != "" {
+			fmt.Fprintf(bw, "# group: %s\n", commentText(s.Group))
+		}
+		fmt.Fprintf(bw, "Host %s\n", aliases[i])
+		fmt.Fprintf(bw, "  HostName %s\n", quoteSSH(s.Host))
+		fmt.Fprintf(bw, "  User %s\n", quoteSSH(s.User))
+		port := s.Port
+		if port <= 0 {
+			port = 22
+		}
+		fmt.Fprintf(bw, "  Port %s\n", strconv.Itoa(port))
+		if s.KeyPath != "" {
+			fmt.Fprintf(bw, "  IdentityFile %s\n", quoteSSH(s.KeyPath))
+		}
+		if jump := rewriteJump(s.ProxyJump, byName); jump != "" {
+			fmt.Fprintf(bw, "  ProxyJump %s\n", quoteSSH(jump))
+		}
+	}
+	return bw.Flush()
+}
+
+// SSHAliases 为每台服务器生成唯一、可用作 Host 模式的别名（空白与通配符替换为 -，重名追加序号）
+func SSHAliases(servers []models.Server) []string {
+	out := make([]string, len(servers))
+	used := make(map[string]int)
+	for i, s := range servers {
+		a := strings.Trim(aliasUnsafe.ReplaceAllString(s.Name, "-"), "-")
+		if a == "" {
+			a = strings.Trim(aliasUnsafe.ReplaceAllString(s.Host, "-"), "-")
+		}
+		used[a]++
+		if n := used[a]; n > 1 {
+			a = fmt.Sprintf("%s-%d", a, n)
+		}
+		out[i] = a
+	}
+	return out
+}
+
+func rewriteJump(jump string, byName map[string]string) string {
+	if strings.TrimSpace(jump) == "" {
+		return ""
+	}
+	var hops []string
+	for _, hop := range strings.Split(jump, ",") {
+		hop = strings.TrimSpace(hop)
+		if hop == "" {
+			continue
+		}
+		if a, ok := byName[hop]; ok {
+			hop = a
+		}
+		hops = append(hops, hop)
+	}
+	return strings.Join(hops, ",")
+}
+
+// quoteSSH 含空白、引号、反斜杠或 # 的值加双引号，引号与反斜杠以反斜杠转义
+func quoteSSH(v string) string {
+	if !strings.ContainsAny(v, " \t\"'\\#") {
+		return v
+	}
+	v = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v)
+	return `"` + v + `"`
+}
+
+// hasControl 任一值含控制字符（换行、回车等）
+func hasControl(values ...string) bool {
+	for _, v := range values {
+		if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// commentText 注释中的控制字符替换为空格，使其保持在一行内
+func commentText(v string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, v)
+}
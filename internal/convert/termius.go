@@ -0,0 +1,143 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/models"
+)
+
+// ParseTermius 解析 Termius 导出的 JSON：hosts 数组中的 label、address、port、username 映射为服务器，
+// 端口与用户名也可位于 ssh_config / identity 中；group（或 group_id）按 groups 的 parent_group 展开为「父/子」分组。
+// Termius 内嵌的私钥内容无法对应到本机文件，记为未支持字段
+func ParseTermius(content string) ([]models.Server, *Report, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &root); err != nil {
+		return nil, nil, fmt.Errorf("解析 Termius JSON 失败: %w", err)
+	}
+	if data, ok := root["data"].(map[string]interface{}); ok {
+		root = data
+	}
+	report := &Report{}
+	groups := make(map[string]map[string]interface{})
+	for _, g := range jsonList(root["groups"]) {
+		groups[jsonStr(g, "id")] = g
+	}
+	hosts := jsonList(root["hosts"])
+	if hosts == nil {
+		return nil, nil, fmt.Errorf("不是 Termius 导出文件（缺少 hosts 数组）")
+	}
+
+	servers := []models.Server{}
+	for i, h := range hosts {
+		sshCfg, _ := h["ssh_config"].(map[string]interface{})
+		identity, _ := h["identity"].(map[string]interface{})
+		if identity == nil && sshCfg != nil {
+			identity, _ = sshCfg["identity"].(map[string]interface{})
+		}
+		s := models.Server{
+			Name: jsonStr(h, "label"),
+			Host: firstNonEmpty(jsonStr(h, "address"), jsonStr(h, "hostname"), jsonStr(h, "host")),
+			User: firstNonEmpty(jsonStr(h, "username"), jsonStr(identity, "username"), jsonStr(sshCfg, "username")),
+			Port: 22,
+		}
+		if s.Name == "" {
+			s.Name = s.Host
+		}
+		if n, err := strconv.Atoi(firstNonEmpty(jsonStr(h, "port"), jsonStr(sshCfg, "port"))); err == nil && n > 0 {
+			s.Port = n
+		}
+		s.Group = termiusGroup(h["group"], h, groups)
+		s.Password = firstNonEmpty(jsonStr(h, "password"), jsonStr(identity, "password"))
+		if identity != nil && identity["ssh_key"] != nil {
+			report.unsupported("ssh_key（Termius 内嵌私钥，需另存为文件后填写私钥路径）")
+		}
+		if len(jsonList(h["port_forwarding"])) > 0 || len(jsonList(h["port_forwardings"])) > 0 {
+			report.unsupported("port_forwarding（端口转发）")
+		}
+		if s.Host == "" {
+			report.rowError(i+1, "缺少 address")
+			continue
+		}
+		if s.User == "" {
+			report.skip(s.Name + "（缺少用户名）")
+			continue
+		}
+		servers = append(servers, s)
+	}
+	return servers, report, nil
+}
+
+// termiusGroup 解析分组：group 可能是 id、名称或内嵌对象，沿 parent_group 向上拼出路径
+func termiusGroup(ref interface{}, host map[string]interface{}, groups map[string]map[string]interface{}) string {
+	var g map[string]interface{}
+	switch v := ref.(type) {
+	case map[string]interface{}:
+		g = v
+	case string:
+		if gg, ok := groups[v]; ok {
+			g = gg
+		} else {
+			return v
+		}
+	case float64:
+		g = groups[strconv.FormatFloat(v, 'f', -1, 64)]
+	}
+	if g == nil {
+		if id := jsonStr(host, "group_id"); id != "" {
+			g = groups[id]
+		}
+	}
+	var path []string
+	for depth := 0; g != nil && depth < 16; depth++ {
+		if label := jsonStr(g, "label"); label != "" {
+			path = append([]string{label}, path...)
+		}
+		parent := g["parent_group"]
+		if p, ok := parent.(map[string]interface{}); ok {
+			g = p
+			continue
+		}
+		g = groups[jsonStr(g, "parent_group")]
+	}
+	return strings.Join(path, "/")
+}
+
+func jsonList(v interface{}) []map[string]interface{} {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	out := make([]map[string]interface{}, 0, len(arr))
+	for _, x := range arr {
+		if m, ok := x.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// jsonStr 取字符串或数字字段，统一转为字符串
+func jsonStr(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	switch v := m[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
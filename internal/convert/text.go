@@ -0,0 +1,28 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// DecodeText 将文件内容转为 UTF-8 字符串：识别 UTF-16 LE/BE 与 UTF-8 的 BOM（Windows 下导出的 .reg、.xsh 多为 UTF-16）
+func DecodeText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], binary.LittleEndian)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], binary.BigEndian)
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:])
+	}
+	return string(data)
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
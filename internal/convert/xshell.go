@@ -0,0 +1,115 @@
+package convert
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/models"
+)
+
+// ParseXshell 解析单个 Xshell 会话文件（.xsh），name 为文件名（会话名取自文件名），group 为所在目录
+func ParseXshell(name, group, content string) ([]models.Server, *Report, error) {
+	report := &Report{}
+	s, ok := parseXsh(name, group, content, report)
+	if !ok {
+		return []models.Server{}, report, nil
+	}
+	return []models.Server{s}, report, nil
+}
+
+// ParseXshellDir 遍历 Xshell 的会话目录（如 Documents/NetSarang Computer/7/Xshell/Sessions），
+// 子目录映射为分组；p 为单个 .xsh 文件时等同 ParseXshell
+func ParseXshellDir(p string) ([]models.Server, *Report, error) {
+	p = expandHome(p)
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ParseXshell(filepath.Base(p), "", DecodeText(data))
+	}
+	report := &Report{}
+	servers := []models.Server{}
+	err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".xsh") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			report.skip(path + "（" + err.Error() + "）")
+			return nil
+		}
+		group, _ := filepath.Rel(p, filepath.Dir(path))
+		if group == "." {
+			group = ""
+		}
+		if s, ok := parseXsh(filepath.Base(path), filepath.ToSlash(group), DecodeText(data), report); ok {
+			servers = append(servers, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return servers, report, nil
+}
+
+func parseXsh(name, group, content string, report *Report) (models.Server, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	vals := make(map[string]string) // 「段名.键」-> 值
+	section := ""
+	sc := bufio.NewScanner(strings.NewReader(content))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToUpper(line[1 : len(line)-1])
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			vals[section+"."+k] = v
+		}
+	}
+	if p := vals["CONNECTION.Protocol"]; p != "" && !strings.EqualFold(p, "SSH") {
+		report.skip(name + "（协议 " + p + "，仅支持 SSH）")
+		return models.Server{}, false
+	}
+	s := models.Server{
+		Name:  name,
+		Host:  vals["CONNECTION.Host"],
+		User:  vals["CONNECTION:AUTHENTICATION.UserName"],
+		Port:  22,
+		Group: group,
+	}
+	if n, err := strconv.Atoi(vals["CONNECTION.Port"]); err == nil && n > 0 {
+		s.Port = n
+	}
+	if vals["CONNECTION:AUTHENTICATION.Password"] != "" {
+		report.unsupported("Password（Xshell 加密存储，无法解密，请导入后重新填写）")
+	}
+	if vals["CONNECTION:AUTHENTICATION.UserKey"] != "" {
+		report.unsupported("UserKey（Xshell 用户密钥库中的密钥，需先导出为文件再填写私钥路径）")
+	}
+	if vals["CONNECTION:PROXY.Proxy"] != "" || vals["CONNECTION:PROXY.ProxyName"] != "" {
+		report.unsupported("Proxy（Xshell 代理设置）")
+	}
+	if s.Host == "" {
+		report.skip(name + "（缺少 Host）")
+		return s, false
+	}
+	if s.User == "" {
+		report.skip(name + "（缺少 UserName）")
+		return s, false
+	}
+	return s, true
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lwshell/internal/config"
+	"lwshell/internal/models"
+	"lwshell/internal/ssh"
+)
+
+const (
+	// MaxSamples 每台服务器保留的最近采样数
+	MaxSamples = 60
+	// collectTimeout 单台服务器一次采集的超时时间
+	collectTimeout = 15 * time.Second
+	// maxParallel 同时采集的服务器数量上限
+	maxParallel = 8
+)
+
+var (
+	series   map[string][]Sample // 服务器 ID -> 按时间排序的采样
+	seriesMu sync.RWMutex
+)
+
+// metricsPath 指标文件路径：os.UserConfigDir()/lwshell/metrics.json
+func metricsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lwshell", "metrics.json"), nil
+}
+
+// load 首次访问时从磁盘读取历史采样（调用方需持有写锁）
+func load() {
+	if series != nil {
+		return
+	}
+	series = make(map[string][]Sample)
+	p, err := metricsPath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, &series)
+	if series == nil {
+		series = make(map[string][]Sample)
+	}
+}
+
+// save 将采样写回磁盘（调用方需持有锁）
+func save() error {
+	p, err := metricsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(series)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0600)
+}
+
+// All 返回所有服务器的采样副本
+func All() map[string][]Sample {
+	seriesMu.Lock()
+	load()
+	out := make(map[string][]Sample, len(series))
+	for id, list := range series {
+		out[id] = append([]Sample(nil), list...)
+	}
+	seriesMu.Unlock()
+	return out
+}
+
+// Collect 通过 SSH 采集单台服务器的指标，jumps 为跳板机链
+func Collect(s models.Server, jumps []models.Server) Sample {
+	now := time.Now().UTC()
+	out, err := ssh.Run(s, jumps, collectCmd, collectTimeout)
+	if err != nil {
+		return Sample{Time: now, Err: err.Error()}
+	}
+	sample, err := parseOutput(out)
+	sample.Time = now
+	if err != nil {
+		return Sample{Time: now, Err: err.Error()}
+	}
+	return sample
+}
+
+// CollectAll 并发采集配置中所有可认证的服务器，并追加到时间序列
+func CollectAll() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	results := make(map[string]Sample)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallel)
+	// 按继承模板后的生效配置采集
+	servers := cfg.ResolvedServers()
+	for _, s := range servers {
+		if s.Password == "" && s.KeyPath == "" {
+			continue // 未配置认证信息，无法非交互登录
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(s models.Server) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var sample Sample
+			if jumps, err := ssh.JumpChain(s, servers); err != nil {
+				sample = Sample{Time: time.Now().UTC(), Err: err.Error()}
+			} else {
+				sample = Collect(s, jumps)
+			}
+			mu.Lock()
+			results[s.ID] = sample
+			mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	load()
+	// ID 迁移为 UUID 后沿用曾用 ID 下的历史；已删除的服务器不再保留历史
+	alive := make(map[string]bool, len(cfg.Servers))
+	for _, s := range cfg.Servers {
+		alive[s.ID] = true
+		for _, a := range s.Aliases {
+			if old, ok := series[a]; ok && series[s.ID] == nil {
+				series[s.ID] = old
+			}
+		}
+	}
+	for id := range series {
+		if !alive[id] {
+			delete(series, id)
+		}
+	}
+	for id, sample := range results {
+		list := append(series[id], sample)
+		if len(list) > MaxSamples {
+			list = list[len(list)-MaxSamples:]
+		}
+		series[id] = list
+	}
+	return save()
+}
+
+// Start 在后台按 interval 周期采集，返回停止采集的函数；interval <= 0 时不启动
+func Start(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			_ = CollectAll()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
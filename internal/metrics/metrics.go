@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sep 各条命令输出之间的分隔行
+const sep = "---lwshell---"
+
+// collectCmd 一次 SSH 会话内执行的命令集合：负载、内存、磁盘、运行时长、内核版本
+var collectCmd = strings.Join([]string{
+	"cat /proc/loadavg",
+	"echo " + sep,
+	"cat /proc/meminfo",
+	"echo " + sep,
+	"df -P -k",
+	"echo " + sep,
+	"cat /proc/uptime",
+	"echo " + sep,
+	"uname -r",
+}, "; ")
+
+// Disk 单个挂载点的磁盘用量（单位 KB）
+type Disk struct {
+	Mount   string  `json:"mount"`
+	Size    uint64  `json:"size_kb"`
+	Used    uint64  `json:"used_kb"`
+	UsedPct float64 `json:"used_pct"`
+}
+
+// Sample 一次采集结果
+type Sample struct {
+	Time         time.Time `json:"time"`
+	Load1        float64   `json:"load1"`
+	Load5        float64   `json:"load5"`
+	Load15       float64   `json:"load15"`
+	MemTotal     uint64    `json:"mem_total_kb"`
+	MemAvailable uint64    `json:"mem_available_kb"`
+	Disks        []Disk    `json:"disks,omitempty"`
+	Uptime       float64   `json:"uptime_seconds"`
+	Kernel       string    `json:"kernel,omitempty"`
+	Err          string    `json:"error,omitempty"` // 采集失败时的错误信息，其余字段为空
+}
+
+// MemUsedPct 内存使用率（0-100）
+func (s Sample) MemUsedPct() float64 {
+	if s.MemTotal == 0 {
+		return 0
+	}
+	return float64(s.MemTotal-s.MemAvailable) * 100 / float64(s.MemTotal)
+}
+
+// parseOutput 解析 collectCmd 的输出
+func parseOutput(out string) (Sample, error) {
+	var s Sample
+	parts := strings.Split(out, sep+"\n")
+	if len(parts) != 5 {
+		return s, fmt.Errorf("输出格式不符合预期（%d 段）", len(parts))
+	}
+	if err := parseLoadavg(parts[0], &s); err != nil {
+		return s, err
+	}
+	parseMeminfo(parts[1], &s)
+	s.Disks = parseDf(parts[2])
+	if f := strings.Fields(parts[3]); len(f) > 0 {
+		s.Uptime, _ = strconv.ParseFloat(f[0], 64)
+	}
+	s.Kernel = strings.TrimSpace(parts[4])
+	return s, nil
+}
+
+// parseLoadavg 解析 /proc/loadavg，如 "0.12 0.08 0.01 1/123 4567"
+func parseLoadavg(text string, s *Sample) error {
+	f := strings.Fields(text)
+	if len(f) < 3 {
+		return fmt.Errorf("无法解析 /proc/loadavg: %q", strings.TrimSpace(text))
+	}
+	var err error
+	if s.Load1, err = strconv.ParseFloat(f[0], 64); err != nil {
+		return err
+	}
+	if s.Load5, err = strconv.ParseFloat(f[1], 64); err != nil {
+		return err
+	}
+	s.Load15, err = strconv.ParseFloat(f[2], 64)
+	return err
+}
+
+// parseMeminfo 解析 /proc/meminfo 中的 MemTotal 与 MemAvailable（旧内核无 MemAvailable 时用 MemFree+Buffers+Cached 估算）
+func parseMeminfo(text string, s *Sample) {
+	vals := make(map[string]uint64)
+	for _, line := range strings.Split(text, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		vals[strings.TrimSuffix(f[0], ":")] = n
+	}
+	s.MemTotal = vals["MemTotal"]
+	if v, ok := vals["MemAvailable"]; ok {
+		s.MemAvailable = v
+	} else {
+		s.MemAvailable = vals["MemFree"] + vals["Buffers"] + vals["Cached"]
+	}
+	if s.MemAvailable > s.MemTotal {
+		s.MemAvailable = s.MemTotal
+	}
+}
+
+// parseDf 解析 df -P -k 输出，忽略 tmpfs 等虚拟文件系统
+func parseDf(text string) []Disk {
+	var disks []Disk
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		if i == 0 {
+			continue // 表头
+		}
+		f := strings.Fields(line)
+		if len(f) < 6 {
+			continue
+		}
+		if isVirtualFS(f[0]) {
+			continue
+		}
+		size, err1 := strconv.ParseUint(f[1], 10, 64)
+		used, err2 := strconv.ParseUint(f[2], 10, 64)
+		if err1 != nil || err2 != nil || size == 0 {
+			continue
+		}
+		disks = append(disks, Disk{
+			Mount:   strings.Join(f[5:], " "),
+			Size:    size,
+			Used:    used,
+			UsedPct: float64(used) * 100 / float64(size),
+		})
+	}
+	return disks
+}
+
+func isVirtualFS(fs string) bool {
+	switch fs {
+	case "tmpfs", "devtmpfs", "overlay", "shm", "udev", "none", "proc", "sysfs", "cgroup", "squashfs":
+		return true
+	}
+	return strings.HasPrefix(fs, "/dev/loop")
+}
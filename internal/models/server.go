@@ -1,18 +1,122 @@
 package models
 
+import "time"
+
 // Server 表示一台 SSH 主机配置
 type Server struct {
-	ID       string `json:"id"`       // 唯一标识
-	Name     string `json:"name"`     // 显示名称
-	Host     string `json:"host"`     // IP 或域名
-	Port     int    `json:"port"`     // 端口，默认 22
-	User     string `json:"user"`     // 登录用户
-	Password string `json:"password"` // 密码（可选，与证书二选一或都填）
-	KeyPath  string `json:"key_path"` // 私钥/证书路径（可选）
-	Group    string `json:"group"`    // 分组名称，用于分组显示
+	ID        string   `json:"id"`                   // 唯一标识（UUID）
+	Name      string   `json:"name"`                 // 显示名称
+	Host      string   `json:"host"`                 // IP 或域名
+	Port      int      `json:"port"`                 // 端口，默认 22
+	User      string   `json:"user"`                 // 登录用户
+	Password  string   `json:"password"`             // 密码（可选，与证书二选一或都填）
+	KeyPath   string   `json:"key_path"`             // 私钥/证书路径（可选）
+	Group     string   `json:"group"`                // 分组名称，用于分组显示
+	ProxyJump string   `json:"proxy_jump,omitempty"` // 跳板机，同 OpenSSH ProxyJump：逗号分隔的 [user@]host[:port] 或其他服务器名称
+	Tags      []string `json:"tags,omitempty"`       // 标签，如 env:prod、role:db，可有多个
+	Template  string   `json:"template,omitempty"`   // 继承的模板 ID：端口、用户、密码、私钥与跳板机为空时取模板中的值
+
+	Notes         string            `json:"notes,omitempty"`          // 备注（Markdown）
+	Fields        map[string]string `json:"fields,omitempty"`         // 自定义字段，如 owner、ticket、rack
+	Favorite      bool              `json:"favorite,omitempty"`       // 收藏，列表中置顶显示
+	LastConnected *time.Time        `json:"last_connected,omitempty"` // 最近一次成功连接的时间，由访问日志更新
+
+	Aliases []string `json:"aliases,omitempty"` // 曾用 ID（旧版自增数字 ID 迁移为 UUID 后保留），按 ID 查找时同样匹配
+}
+
+// HasID 判断 id 是否为该服务器的 ID 或曾用 ID
+func (s *Server) HasID(id string) bool {
+	if id == "" {
+		return false
+	}
+	if s.ID == id {
+		return true
+	}
+	for _, a := range s.Aliases {
+		if a == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Template 服务器模板：多台服务器共用的端口、用户、认证与跳板机。
+// 服务器中对应字段为空（端口为 0）时继承模板，非空时覆盖模板；修改模板即修改所有继承它的服务器
+type Template struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Port      int    `json:"port,omitempty"`
+	User      string `json:"user,omitempty"`
+	Password  string `json:"password,omitempty"`
+	KeyPath   string `json:"key_path,omitempty"`
+	ProxyJump string `json:"proxy_jump,omitempty"`
 }
 
-// Config 持久化配置：服务器列表
+// Config 持久化配置：服务器列表与模板
 type Config struct {
-	Servers []Server `json:"servers"`
+	Servers   []Server   `json:"servers"`
+	Templates []Template `json:"templates,omitempty"`
+}
+
+// FindTemplate 按 ID 或名称（便于手工编辑配置）查找模板，未找到返回 nil
+func (c *Config) FindTemplate(ref string) *Template {
+	if ref == "" {
+		return nil
+	}
+	for i := range c.Templates {
+		if c.Templates[i].ID == ref {
+			return &c.Templates[i]
+		}
+	}
+	for i := range c.Templates {
+		if c.Templates[i].Name == ref {
+			return &c.Templates[i]
+		}
+	}
+	return nil
+}
+
+// Resolve 返回服务器的生效配置：空字段由所继承的模板补全，端口仍为空时取 22。
+// 连接、采集指标与导出为其他格式时都应使用生效配置
+func (c *Config) Resolve(s Server) Server {
+	if t := c.FindTemplate(s.Template); t != nil {
+		if s.Port <= 0 {
+			s.Port = t.Port
+		}
+		if s.User == "" {
+			s.User = t.User
+		}
+		if s.Password == "" {
+			s.Password = t.Password
+		}
+		if s.KeyPath == "" {
+			s.KeyPath = t.KeyPath
+		}
+		if s.ProxyJump == "" {
+			s.ProxyJump = t.ProxyJump
+		}
+	}
+	if s.Port <= 0 {
+		s.Port = 22
+	}
+	return s
+}
+
+// ResolvedServers 返回所有服务器的生效配置（用于解析按名称引用的跳板机）
+func (c *Config) ResolvedServers() []Server {
+	out := make([]Server, len(c.Servers))
+	for i, s := range c.Servers {
+		out[i] = c.Resolve(s)
+	}
+	return out
+}
+
+// Find 按 ID 或曾用 ID 查找服务器，未找到返回 nil
+func (c *Config) Find(id string) *Server {
+	for i := range c.Servers {
+		if c.Servers[i].HasID(id) {
+			return &c.Servers[i]
+		}
+	}
+	return nil
 }
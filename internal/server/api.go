@@ -2,32 +2,59 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
+	"lwshell/internal/audit"
+	"lwshell/internal/auth"
 	"lwshell/internal/config"
 	"lwshell/internal/models"
+	"lwshell/internal/ssh"
 )
 
 // GroupResp 分组（不含密码）
 type GroupResp struct {
-	Name    string         `json:"name"`
-	Servers []ServerResp    `json:"servers"`
+	Name    string       `json:"name"`
+	Servers []ServerResp `json:"servers"`
 }
 
 // ServerResp 对外暴露的服务器信息（不含密码）
 type ServerResp struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Host    string `json:"host"`
-	Port    int    `json:"port"`
-	User    string `json:"user"`
-	KeyPath string `json:"key_path,omitempty"`
-	Group   string `json:"group"`
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Host      string   `json:"host"`
+	Port      int      `json:"port"`
+	User      string   `json:"user"`
+	KeyPath   string   `json:"key_path,omitempty"`
+	Group     string   `json:"group"`
+	ProxyJump string   `json:"proxy_jump,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Template  string   `json:"template,omitempty"`
+	Rev       string   `json:"rev"` // 版本号，修改 / 删除时通过 If-Match 请求头带回以检测冲突
+
+	Notes         string            `json:"notes,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`
+	Favorite      bool              `json:"favorite,omitempty"`
+	LastConnected *time.Time        `json:"last_connected,omitempty"`
+
+	// Effective 继承模板后的生效值（仅设置了模板时返回），上面的字段为服务器自身的值（空表示继承）
+	Effective *EffectiveResp `json:"effective,omitempty"`
+}
+
+// EffectiveResp 服务器继承模板后的生效连接参数（不含密码）
+type EffectiveResp struct {
+	Port        int    `json:"port"`
+	User        string `json:"user"`
+	KeyPath     string `json:"key_path,omitempty"`
+	ProxyJump   string `json:"proxy_jump,omitempty"`
+	HasPassword bool   `json:"has_password"`
 }
 
 // ConnectReq POST /api/connect 请求体
@@ -35,37 +62,63 @@ type ConnectReq struct {
 	ID string `json:"id"`
 }
 
-func groupsFromConfig(cfg *models.Config) []GroupResp {
+// ungroupedName 未设置分组的服务器显示在此分组下
+const ungroupedName = "未分组"
+
+// toServerResp 转为对外结构（去掉密码）；继承模板的服务器附带生效值
+func toServerResp(cfg *models.Config, s models.Server) ServerResp {
+	resp := ServerResp{
+		ID:        s.ID,
+		Name:      s.Name,
+		Host:      s.Host,
+		Port:      s.Port,
+		User:      s.User,
+		KeyPath:   s.KeyPath,
+		Group:     s.Group,
+		ProxyJump: s.ProxyJump,
+		Tags:      s.Tags,
+		Rev:       config.Revision(s),
+
+		Notes:         s.Notes,
+		Fields:        s.Fields,
+		Favorite:      s.Favorite,
+		LastConnected: s.LastConnected,
+		Template:      s.Template,
+	}
+	if s.Template != "" {
+		e := cfg.Resolve(s)
+		resp.Effective = &EffectiveResp{
+			Port:        e.Port,
+			User:        e.User,
+			KeyPath:     e.KeyPath,
+			ProxyJump:   e.ProxyJump,
+			HasPassword: e.Password != "",
+		}
+	}
+	return resp
+}
+
+// groupsFromConfig 按完整分组路径平铺分组（名称排序，「未分组」在最后）
+func groupsFromConfig(cfg *models.Config, f ServerFilter) []GroupResp {
 	m := make(map[string][]ServerResp)
 	for _, s := range cfg.Servers {
+		if !f.match(s) {
+			continue
+		}
 		g := s.Group
 		if g == "" {
-			g = "未分组"
+			g = ungroupedName
 		}
-		m[g] = append(m[g], ServerResp{
-			ID:      s.ID,
-			Name:    s.Name,
-			Host:    s.Host,
-			Port:    s.Port,
-			User:    s.User,
-			KeyPath: s.KeyPath,
-			Group:   s.Group,
-		})
+		m[g] = append(m[g], toServerResp(cfg, s))
 	}
 	names := []string{}
 	for k := range m {
-		if k != "未分组" {
+		if k != ungroupedName {
 			names = append(names, k)
 		}
 	}
-	for i := 0; i < len(names); i++ {
-		for j := i + 1; j < len(names); j++ {
-			if names[j] < names[i] {
-				names[i], names[j] = names[j], names[i]
-			}
-		}
-	}
-	names = append(names, "未分组")
+	sort.Strings(names)
+	names = append(names, ungroupedName)
 	out := make([]GroupResp, 0, len(names))
 	for _, n := range names {
 		if _, ok := m[n]; ok {
@@ -96,6 +149,14 @@ func ServersAPI(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "missing server id", http.StatusBadRequest)
 			return
 		}
+		if strings.HasSuffix(id, "/favorite") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			SetFavorite(w, r, strings.TrimSuffix(id, "/favorite"))
+			return
+		}
 		switch r.Method {
 		case http.MethodPut:
 			UpdateServer(w, r, id)
@@ -110,40 +171,44 @@ func ServersAPI(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
-// GetServers 返回分组后的服务器列表（不含密码）
+// GetServers 返回分组后的服务器列表（不含密码）：groups 为按完整路径平铺的分组，tree 为按 / 拆分的目录树，favorites 为收藏的服务器（置顶显示）；
+// 支持 ?q=关键词、?tag=标签（可重复）、?group=分组 筛选，tags 为全部标签，total 为筛选前的服务器总数
 func GetServers(w http.ResponseWriter, r *http.Request) {
 	cfg, err := config.Load()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	query := r.URL.Query()
+	f := ServerFilter{Q: query.Get("q"), Tags: query["tag"], Group: query.Get("group")}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{"groups": groupsFromConfig(cfg)})
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"groups":    groupsFromConfig(cfg, f),
+		"tree":      treeFromConfig(cfg, f),
+		"favorites": favoritesFromConfig(cfg, f),
+		"tags":      allTags(cfg.Servers),
+		"total":     len(cfg.Servers),
+		"filtered":  !f.empty(),
+	})
 }
 
 // ServerBody 创建/编辑时的请求体（密码可选）
 // 编辑时 Password 为 nil 表示不修改原密码，空字符串表示清空
 type ServerBody struct {
-	Name     string  `json:"name"`
-	Host     string  `json:"host"`
-	Port     int     `json:"port"`
-	User     string  `json:"user"`
-	Password *string `json:"password,omitempty"`
-	KeyPath  string  `json:"key_path"`
-	Group    string  `json:"group"`
-}
-
-func nextID(servers []models.Server) string {
-	max := 0
-	for _, s := range servers {
-		if s.ID != "" {
-			n, _ := strconv.Atoi(s.ID)
-			if n > max {
-				max = n
-			}
-		}
-	}
-	return strconv.Itoa(max + 1)
+	Name      string   `json:"name"`
+	Host      string   `json:"host"`
+	Port      int      `json:"port"`
+	User      string   `json:"user"`
+	Password  *string  `json:"password,omitempty"`
+	KeyPath   string   `json:"key_path"`
+	Group     string   `json:"group"`
+	ProxyJump string   `json:"proxy_jump"`
+	Tags      []string `json:"tags"`
+	Template  string   `json:"template"` // 模板 ID 或名称；设置后端口、用户等留空即继承模板
+	// 以下字段编辑时为 null（或省略）表示不修改，便于旧客户端与只改部分字段的调用
+	Notes    *string           `json:"notes,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"` // 传 {} 清空
+	Favorite *bool             `json:"favorite,omitempty"`
 }
 
 // CreateServer 添加服务器
@@ -153,19 +218,7 @@ func CreateServer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	body.Name = strings.TrimSpace(body.Name)
-	body.Host = strings.TrimSpace(body.Host)
-	body.User = strings.TrimSpace(body.User)
-	if body.Name == "" || body.Host == "" || body.User == "" {
-		http.Error(w, "name, host, user required", http.StatusBadRequest)
-		return
-	}
-	if body.Port <= 0 {
-		body.Port = 22
-	}
-	cfg, err := config.Load()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !body.normalize(w) {
 		return
 	}
 	pwd := ""
@@ -173,23 +226,49 @@ func CreateServer(w http.ResponseWriter, r *http.Request) {
 		pwd = strings.TrimSpace(*body.Password)
 	}
 	s := models.Server{
-		ID:       nextID(cfg.Servers),
-		Name:     body.Name,
-		Host:     body.Host,
-		Port:     body.Port,
-		User:     body.User,
-		Password: pwd,
-		KeyPath:  strings.TrimSpace(body.KeyPath),
-		Group:    strings.TrimSpace(body.Group),
-	}
-	cfg.Servers = append(cfg.Servers, s)
-	if err := config.Save(cfg); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ID:        config.NewID(),
+		Name:      body.Name,
+		Host:      body.Host,
+		Port:      body.Port,
+		User:      body.User,
+		Password:  pwd,
+		KeyPath:   strings.TrimSpace(body.KeyPath),
+		Group:     normalizeGroup(body.Group),
+		ProxyJump: strings.TrimSpace(body.ProxyJump),
+		Tags:      normalizeTags(body.Tags),
+		Template:  body.Template,
+		Fields:    normalizeFields(body.Fields),
+	}
+	if body.Notes != nil {
+		s.Notes = strings.TrimSpace(*body.Notes)
+	}
+	if body.Favorite != nil {
+		s.Favorite = *body.Favorite
+	}
+	if !auth.Can(r, auth.PermEdit, s.Group) {
+		auth.Forbidden(w)
 		return
 	}
+	err := config.Update(func(cfg *models.Config) error {
+		if err := applyTemplate(cfg, &s); err != nil {
+			return err
+		}
+		if err := checkReferences(r, cfg, &s, nil); err != nil {
+			return err
+		}
+		cfg.Servers = append(cfg.Servers, s)
+		return nil
+	})
+	if err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	audit.LogChange("server_create", auth.Actor(r), s.ID, "name", s.Name, "group", s.Group)
+	rev := config.Revision(s)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+rev+`"`)
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(map[string]string{"id": s.ID})
+	_ = json.NewEncoder(w).Encode(map[string]string{"id": s.ID, "rev": rev})
 }
 
 // UpdateServer 编辑服务器
@@ -199,73 +278,307 @@ func UpdateServer(w http.ResponseWriter, r *http.Request, id string) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	body.Name = strings.TrimSpace(body.Name)
-	body.Host = strings.TrimSpace(body.Host)
-	body.User = strings.TrimSpace(body.User)
-	if body.Name == "" || body.Host == "" || body.User == "" {
-		http.Error(w, "name, host, user required", http.StatusBadRequest)
+	if !body.normalize(w) {
 		return
 	}
-	if body.Port <= 0 {
-		body.Port = 22
-	}
-	cfg, err := config.Load()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	found := false
-	for i := range cfg.Servers {
-		if cfg.Servers[i].ID == id {
-			cfg.Servers[i].Name = body.Name
-			cfg.Servers[i].Host = body.Host
-			cfg.Servers[i].Port = body.Port
-			cfg.Servers[i].User = body.User
+	ifMatch := ifMatchRev(r)
+	var (
+		rev     string
+		changed  models.Server
+		cleared  bool
+		detached bool
+	)
+	err := config.Update(func(cfg *models.Config) error {
+		for i := range cfg.Servers {
+			s := &cfg.Servers[i]
+			if !s.HasID(id) {
+				continue
+			}
+			if !auth.Can(r, auth.PermEdit, s.Group) || !auth.Can(r, auth.PermEdit, normalizeGroup(body.Group)) {
+				return errForbidden
+			}
+			if ifMatch != "" && config.Revision(*s) != ifMatch {
+				return config.ErrConflict
+			}
+			old := *s
+			s.Name = body.Name
+			s.Host = body.Host
+			s.Port = body.Port
+			s.User = body.User
 			if body.Password != nil {
-				cfg.Servers[i].Password = strings.TrimSpace(*body.Password)
+				s.Password = strings.TrimSpace(*body.Password)
+			} else if s.Host != old.Host || s.Port != old.Port || s.User != old.User {
+				// 换了连接目标却沿用原密码，会把密码发给新主机；须随修改重新填写
+				cleared = s.Password != ""
+				s.Password = ""
+			}
+			s.KeyPath = strings.TrimSpace(body.KeyPath)
+			s.Group = normalizeGroup(body.Group)
+			s.ProxyJump = strings.TrimSpace(body.ProxyJump)
+			s.Tags = normalizeTags(body.Tags)
+			s.Template = body.Template
+			if err := applyTemplate(cfg, s); err != nil {
+				return err
+			}
+			if err := checkReferences(r, cfg, s, &old); err != nil {
+				return err
+			}
+			if (s.Host != old.Host || s.Port != old.Port || s.User != old.User) && !auth.Can(r, auth.PermAdmin, "") {
+				detached = detachCredentials(cfg, s)
+			}
+			if body.Notes != nil {
+				s.Notes = strings.TrimSpace(*body.Notes)
+			}
+			if body.Fields != nil {
+				s.Fields = normalizeFields(body.Fields)
 			}
-			cfg.Servers[i].KeyPath = strings.TrimSpace(body.KeyPath)
-			cfg.Servers[i].Group = strings.TrimSpace(body.Group)
-			found = true
-			break
+			if body.Favorite != nil {
+				s.Favorite = *body.Favorite
+			}
+			rev, changed = config.Revision(*s), *s
+			return nil
 		}
+		return errServerNotFound
+	})
+	if err != nil {
+		writeUpdateError(w, err)
+		return
 	}
-	if !found {
-		http.Error(w, "server not found", http.StatusNotFound)
+	kv := []string{"name", changed.Name, "group", changed.Group}
+	if cleared {
+		kv = append(kv, "password_cleared", "1")
+	}
+	if detached {
+		kv = append(kv, "template_detached", "1")
+	}
+	audit.LogChange("server_update", auth.Actor(r), changed.ID, kv...)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+rev+`"`)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "rev": rev})
+}
+
+// FavoriteReq POST /api/servers/:id/favorite 请求体
+type FavoriteReq struct {
+	Favorite bool `json:"favorite"`
+}
+
+// SetFavorite 收藏或取消收藏；不检查 If-Match（只改动收藏标记，不会覆盖他人的编辑）
+func SetFavorite(w http.ResponseWriter, r *http.Request, id string) {
+	var req FavoriteReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json, need {\"favorite\":true|false}", http.StatusBadRequest)
 		return
 	}
-	if err := config.Save(cfg); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var rev string
+	err := config.Update(func(cfg *models.Config) error {
+		s := cfg.Find(id)
+		if s == nil {
+			return errServerNotFound
+		}
+		if !auth.Can(r, auth.PermEdit, s.Group) {
+			return errForbidden
+		}
+		s.Favorite = req.Favorite
+		rev = config.Revision(*s)
+		return nil
+	})
+	if err != nil {
+		writeUpdateError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	w.Header().Set("ETag", `"`+rev+`"`)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "rev": rev})
+}
+
+// favoritesFromConfig 收藏的服务器（按名称排序），同时仍出现在各自的分组中
+func favoritesFromConfig(cfg *models.Config, f ServerFilter) []ServerResp {
+	out := []ServerResp{}
+	for _, s := range cfg.Servers {
+		if s.Favorite && f.match(s) {
+			out = append(out, toServerResp(cfg, s))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// normalizeFields 去掉字段名与值首尾空白，丢弃空字段名；没有字段时返回 nil
+func normalizeFields(fields map[string]string) map[string]string {
+	var out map[string]string
+	for k, v := range fields {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out
 }
 
 // DeleteServer 删除服务器
 func DeleteServer(w http.ResponseWriter, r *http.Request, id string) {
-	cfg, err := config.Load()
+	ifMatch := ifMatchRev(r)
+	var deleted models.Server
+	err := config.Update(func(cfg *models.Config) error {
+		for i, s := range cfg.Servers {
+			if !s.HasID(id) {
+				continue
+			}
+			if !auth.Can(r, auth.PermEdit, s.Group) {
+				return errForbidden
+			}
+			if ifMatch != "" && config.Revision(s) != ifMatch {
+				return config.ErrConflict
+			}
+			deleted = s
+			cfg.Servers = append(cfg.Servers[:i], cfg.Servers[i+1:]...)
+			return nil
+		}
+		return errServerNotFound
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeUpdateError(w, err)
 		return
 	}
-	newList := make([]models.Server, 0, len(cfg.Servers))
-	for _, s := range cfg.Servers {
-		if s.ID != id {
-			newList = append(newList, s)
+	audit.LogChange("server_delete", auth.Actor(r), deleted.ID, "name", deleted.Name, "group", deleted.Group)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+var (
+	errServerNotFound   = errors.New("server not found")
+	errTemplateNotFound = errors.New("template not found")
+	errUserRequired     = errors.New("user required (or inherit it from a template)")
+	errForbidden        = errors.New("forbidden")
+	errNameUsed         = errors.New("该名称已被无权编辑的服务器使用（跳板机按名称引用），请换一个名称")
+)
+
+// normalize 去掉首尾空白并校验必填项，失败时写入 400 并返回 false。
+// 未使用模板时用户必填、端口缺省为 22；使用模板时留空的字段继承模板（见 applyTemplate）
+func (b *ServerBody) normalize(w http.ResponseWriter) bool {
+	b.Name = strings.TrimSpace(b.Name)
+	b.Host = strings.TrimSpace(b.Host)
+	b.User = strings.TrimSpace(b.User)
+	b.Template = strings.TrimSpace(b.Template)
+	if b.Name == "" || b.Host == "" || (b.User == "" && b.Template == "") {
+		http.Error(w, "name, host, user required", http.StatusBadRequest)
+		return false
+	}
+	if b.Port <= 0 && b.Template == "" {
+		b.Port = 22
+	}
+	if b.Port < 0 {
+		b.Port = 0
+	}
+	return true
+}
+
+// applyTemplate 将 s.Template（ID 或名称）规范为模板 ID，并确认继承后有登录用户
+func applyTemplate(cfg *models.Config, s *models.Server) error {
+	if s.Template == "" {
+		return nil
+	}
+	t := cfg.FindTemplate(s.Template)
+	if t == nil {
+		return errTemplateNotFound
+	}
+	s.Template = t.ID
+	if cfg.Resolve(*s).User == "" {
+		return errUserRequired
+	}
+	return nil
+}
+
+// detachCredentials 模板提供密码或私钥时解除模板：继承的端口、用户与跳板机写入服务器本身，密码与私钥只保留服务器自己的。
+// 非管理员修改连接目标时调用，否则清除密码后仍会继承模板中其他分组共用的认证信息并发给新主机；返回是否解除
+func detachCredentials(cfg *models.Config, s *models.Server) bool {
+	t := cfg.FindTemplate(s.Template)
+	if t == nil || (t.Password == "" && t.KeyPath == "") {
+		return false
+	}
+	pwd, key := s.Password, s.KeyPath
+	*s = cfg.Resolve(*s)
+	s.Template, s.Password, s.KeyPath = "", pwd, key
+	return true
+}
+
+// checkReferences 检查服务器引用的模板、跳板机与名称是否越权（old 为修改前的服务器，创建时为 nil）：
+// 模板带有其他分组可能在用的密码与私钥，只有管理员可以设置或更换；按名称引用的跳板机须有其分组的连接权限，
+// 否则可借其保存的认证信息连接；名称不能与无权编辑的服务器相同，避免顶替其他服务器引用的跳板机
+func checkReferences(r *http.Request, cfg *models.Config, s *models.Server, old *models.Server) error {
+	if auth.Can(r, auth.PermAdmin, "") {
+		return nil
+	}
+	oldTemplate := ""
+	if old != nil {
+		oldTemplate = old.Template
+	}
+	if t := cfg.FindTemplate(oldTemplate); t != nil {
+		oldTemplate = t.ID
+	}
+	if s.Template != oldTemplate {
+		return fmt.Errorf("%w: 只有管理员可以设置或更换模板", errForbidden)
+	}
+	for _, hop := range strings.Split(s.ProxyJump, ",") {
+		hop = strings.TrimSpace(hop)
+		if js := findServerByName(cfg, hop); js != nil && !js.HasID(s.ID) && !auth.Can(r, auth.PermConnect, js.Group) {
+			return fmt.Errorf("%w: 无权使用跳板机 %s", errForbidden, hop)
 		}
 	}
-	if len(newList) == len(cfg.Servers) {
-		http.Error(w, "server not found", http.StatusNotFound)
-		return
+	for i := range cfg.Servers {
+		o := &cfg.Servers[i]
+		if o.Name == s.Name && !o.HasID(s.ID) && !auth.Can(r, auth.PermEdit, o.Group) {
+			return errNameUsed
+		}
 	}
-	cfg.Servers = newList
-	if err := config.Save(cfg); err != nil {
+	return nil
+}
+
+// findServerByName 与 ssh.JumpChain 相同，取第一台同名的服务器
+func findServerByName(cfg *models.Config, name string) *models.Server {
+	if name == "" {
+		return nil
+	}
+	for i := range cfg.Servers {
+		if cfg.Servers[i].Name == name {
+			return &cfg.Servers[i]
+		}
+	}
+	return nil
+}
+
+// ifMatchRev 读取 If-Match 请求头中的版本号（去掉引号与弱校验前缀 W/）；未携带或为 * 时不做冲突检查
+func ifMatchRev(r *http.Request) string {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "*" {
+		return ""
+	}
+	v = strings.TrimPrefix(v, "W/")
+	return strings.Trim(v, `"`)
+}
+
+// writeUpdateError 将 config.Update 的错误映射为 HTTP 状态码：不存在 404，无权限 403，版本冲突 412，名称被占用 409，模板无效 400
+func writeUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errServerNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, config.ErrConflict):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case err == errForbidden:
+		auth.Forbidden(w)
+	case errors.Is(err, errForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errNameUsed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errTemplateNotFound), errors.Is(err, errUserRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
 // Connect 在新终端窗口连接指定服务器（仅 macOS 用 osascript 打开 Terminal）
@@ -284,24 +597,37 @@ func Connect(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var target *models.Server
-	for i := range cfg.Servers {
-		if cfg.Servers[i].ID == req.ID {
-			target = &cfg.Servers[i]
-			break
-		}
-	}
+	target := cfg.Find(req.ID)
 	if target == nil {
 		http.Error(w, "server not found", http.StatusNotFound)
 		return
 	}
+	if !auth.Can(r, auth.PermConnect, target.Group) {
+		auth.Forbidden(w)
+		return
+	}
+	// 经过的跳板机若是已配置的服务器，同样须有其分组的连接权限（连接时会使用其保存的密码与私钥）
+	jumps, err := ssh.JumpChain(cfg.Resolve(*target), cfg.ResolvedServers())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, j := range jumps {
+		if j.ID != "" && !auth.Can(r, auth.PermConnect, j.Group) {
+			http.Error(w, "无权使用跳板机 "+j.Name, http.StatusForbidden)
+			return
+		}
+	}
 	exe, err := os.Executable()
 	if err != nil {
 		http.Error(w, "cannot get executable path", http.StatusInternalServerError)
 		return
 	}
 	// 路径含空格时用单引号包裹，便于 Terminal 正确解析
-	connectCmd := "'" + escapeSingleQuotes(exe) + "' --connect-id=" + req.ID
+	connectCmd := "'" + escapeSingleQuotes(exe) + "' --connect-id=" + target.ID
+	if actor := auth.Actor(r); actor != "" {
+		connectCmd += " --connect-user='" + escapeSingleQuotes(actor) + "'"
+	}
 	if runtime.GOOS == "darwin" {
 		// 新开 Terminal 窗口执行：当前二进制 --connect-id=ID
 		script := `tell application "Terminal" to do script "` + escapeAppleScript(connectCmd) + `"`
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lwshell/internal/auth"
+	"lwshell/internal/config"
+	"lwshell/internal/models"
+)
+
+// useTempConfig 将配置目录指向临时目录，测试之间互不影响
+func useTempConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+}
+
+// login 创建用户并登录，返回带会话 Cookie 的请求构造函数
+func login(t *testing.T, name, role string, grants []auth.Grant) func(method, path, body string) *http.Request {
+	t.Helper()
+	if err := auth.CreateUser(name, "password123", role, grants); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	auth.Login(w, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"`+name+`","password":"password123"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login %s: %d %s", name, w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	return func(method, path, body string) *http.Request {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		return r
+	}
+}
+
+func TestUpdateHostDetachesTemplateCredentials(t *testing.T) {
+	useTempConfig(t)
+	cfg := &models.Config{
+		Templates: []models.Template{{ID: "tpl", Name: "shared", User: "root", Password: "SHARED", KeyPath: "/keys/shared"}},
+		Servers:   []models.Server{{ID: "s1", Name: "devbox", Host: "10.0.0.1", Group: "dev", Template: "tpl"}},
+	}
+	if err := config.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	req := login(t, "dev", auth.RoleOperator, []auth.Grant{{Group: "dev", Perms: []auth.Perm{auth.PermConnect, auth.PermEdit}}})
+	update := auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) { UpdateServer(w, r, "s1") })
+
+	w := httptest.NewRecorder()
+	update(w, req(http.MethodPut, "/api/servers/s1", `{"name":"devbox","host":"attacker.example","group":"dev","template":"tpl"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cfg.Resolve(*cfg.Find("s1"))
+	if s.Password != "" || s.KeyPath != "" {
+		t.Fatalf("resolved credentials after host change: password %q key %q", s.Password, s.KeyPath)
+	}
+	if s.Template != "" || s.User != "root" || s.Host != "attacker.example" {
+		t.Fatalf("got template %q user %q host %q", s.Template, s.User, s.Host)
+	}
+}
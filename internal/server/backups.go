@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"lwshell/internal/audit"
+	"lwshell/internal/auth"
+	"lwshell/internal/config"
+	"lwshell/internal/models"
+)
+
+// BackupsAPI 配置快照：
+// GET /api/backups 列出快照；GET /api/backups?name=xxx 返回恢复该快照相对当前配置的变更；
+// POST /api/backups {"name":"xxx"} 恢复快照（恢复前的配置同样会保存为快照）
+func BackupsAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if name := r.URL.Query().Get("name"); name != "" {
+			diffBackup(w, name)
+			return
+		}
+		list, err := config.ListBackups()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"backups": list})
+	case http.MethodPost:
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if _, err := config.LoadBackup(body.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		cfg, err := config.RestoreBackup(body.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit.LogChange("backup_restore", auth.Actor(r), "", "name", body.Name, "servers", strconv.Itoa(len(cfg.Servers)))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "count": len(cfg.Servers)})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func diffBackup(w http.ResponseWriter, name string) {
+	snap, err := config.LoadBackup(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	cur, err := config.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    name,
+		"count":   len(snap.Servers),
+		"changes": DiffServers(cur.Servers, snap.Servers),
+	})
+}
+
+// DiffServers 按 ID（含曾用 ID）比较两份服务器列表，返回从 from 变为 to 所需的变更（create / update / delete，不含未变化项）
+func DiffServers(from, to []models.Server) []ImportChange {
+	changes := []ImportChange{}
+	old := &models.Config{Servers: from}
+	seen := make(map[string]bool, len(to))
+	for _, s := range to {
+		prev := old.Find(s.ID)
+		for _, a := range s.Aliases {
+			if prev == nil {
+				prev = old.Find(a)
+			}
+		}
+		if prev == nil {
+			changes = append(changes, ImportChange{Action: "create", ID: s.ID, Name: s.Name, Host: s.Host})
+			continue
+		}
+		seen[prev.ID] = true
+		if fields := diffFields(*prev, s); len(fields) > 0 {
+			changes = append(changes, ImportChange{Action: "update", ID: s.ID, Name: s.Name, Host: s.Host, Fields: fields})
+		}
+	}
+	for _, s := range from {
+		if !seen[s.ID] {
+			changes = append(changes, ImportChange{Action: "delete", ID: s.ID, Name: s.Name, Host: s.Host})
+		}
+	}
+	return changes
+}
@@ -2,16 +2,38 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"reflect"
 	"strconv"
 	"strings"
 
+	"lwshell/internal/audit"
+	"lwshell/internal/auth"
+	"lwshell/internal/bundle"
 	"lwshell/internal/config"
+	"lwshell/internal/convert"
 	"lwshell/internal/models"
 )
 
-// Export 导出完整服务器配置为 JSON（含密码），便于迁移或备份
+// ExportReq POST /api/export 请求体：加密导出时使用，避免口令出现在 URL 中
+type ExportReq struct {
+	Format            string `json:"format"`
+	Passphrase        string `json:"passphrase"`
+	IncludeKeys       bool   `json:"include_keys"`        // 附带服务器引用的私钥文件
+	IncludeKnownHosts bool   `json:"include_known_hosts"` // 附带 ~/.ssh/known_hosts
+}
+
+// Export 导出服务器配置：默认为完整 JSON（含密码），便于迁移或备份；
+// ?format=ssh_config 导出为 OpenSSH 配置，?format=csv 导出为带表头的 CSV，
+// ?format=ansible_ini / ansible_yaml 导出为 Ansible inventory（均不含密码）；
+// POST {"format":"bundle","passphrase":...} 导出为口令加密的备份包
 func Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		exportBundle(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -21,6 +43,43 @@ func Export(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	cfg = exportable(r, cfg)
+	// 其他格式没有模板的概念，导出继承模板后的生效配置
+	servers := cfg.ResolvedServers()
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", FormatJSON, FormatSSHConfig, FormatCSV, FormatAnsibleINI, FormatAnsibleYAML:
+		audit.LogChange("export", auth.Actor(r), "", "format", exportFormat(format), "servers", strconv.Itoa(len(servers)))
+	}
+	switch format {
+	case "", FormatJSON:
+	case FormatSSHConfig:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="lwshell-ssh_config"`)
+		_ = convert.WriteSSHConfig(w, servers)
+		return
+	case FormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="lwshell-servers.csv"`)
+		_ = convert.WriteCSV(w, servers)
+		return
+	case FormatAnsibleINI:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="inventory.ini"`)
+		_ = convert.WriteAnsibleINI(w, servers)
+		return
+	case FormatAnsibleYAML:
+		w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="inventory.yml"`)
+		_ = convert.WriteAnsibleYAML(w, servers)
+		return
+	case FormatBundle:
+		http.Error(w, "encrypted export requires POST with passphrase", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.Error(w, "unsupported format: "+format, http.StatusBadRequest)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Content-Disposition", `attachment; filename="lwshell-servers.json"`)
 	data, err := json.MarshalIndent(cfg, "", "  ")
@@ -31,13 +90,150 @@ func Export(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
-// ImportReq 导入请求：servers 为要导入的列表，replace 为 true 时替换全部，false 时与当前合并
+// exportFormat 审计日志中的导出格式名（未指定时为 json）
+func exportFormat(format string) string {
+	if format == "" {
+		return FormatJSON
+	}
+	return format
+}
+
+// exportable 只保留当前用户有导出权限的分组中的服务器，以及这些服务器引用的模板
+func exportable(r *http.Request, cfg *models.Config) *models.Config {
+	if auth.Can(r, auth.PermAdmin, "") {
+		return cfg
+	}
+	out := *cfg
+	out.Servers = []models.Server{}
+	used := make(map[string]bool)
+	for _, s := range cfg.Servers {
+		if !auth.Can(r, auth.PermExport, s.Group) {
+			continue
+		}
+		out.Servers = append(out.Servers, s)
+		if t := cfg.FindTemplate(s.Template); t != nil {
+			used[t.ID] = true
+		}
+	}
+	out.Templates = nil
+	for _, t := range cfg.Templates {
+		if used[t.ID] {
+			out.Templates = append(out.Templates, t)
+		}
+	}
+	return &out
+}
+
+// exportBundle 生成口令加密的导出包；读取失败的私钥路径通过 X-Lwshell-Missing-Keys 响应头返回
+func exportBundle(w http.ResponseWriter, r *http.Request) {
+	var req ExportReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Format != FormatBundle {
+		http.Error(w, "unsupported format: "+req.Format, http.StatusBadRequest)
+		return
+	}
+	if len(req.Passphrase) < minPassphraseLen {
+		http.Error(w, fmt.Sprintf("口令至少 %d 位", minPassphraseLen), http.StatusBadRequest)
+		return
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// 私钥文件不属于任何分组，只有管理员可以打包
+	if req.IncludeKeys && !auth.Can(r, auth.PermAdmin, "") {
+		http.Error(w, "只有管理员可以在导出中包含私钥文件", http.StatusForbidden)
+		return
+	}
+	cfg = exportable(r, cfg)
+	b, missing := bundle.Build(cfg, req.IncludeKeys, req.IncludeKnownHosts)
+	data, err := bundle.Seal(b, req.Passphrase)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.LogChange("export", auth.Actor(r), "", "format", FormatBundle, "servers", strconv.Itoa(len(cfg.Servers)),
+		"keys", strconv.FormatBool(req.IncludeKeys), "known_hosts", strconv.FormatBool(req.IncludeKnownHosts))
+	if len(missing) > 0 {
+		w.Header().Set("X-Lwshell-Missing-Keys", strings.Join(missing, ","))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="lwshell-backup.lwbundle"`)
+	_, _ = w.Write(data)
+}
+
+// minPassphraseLen 加密导出口令的最小长度
+const minPassphraseLen = 8
+
+// 导入 / 导出格式
+const (
+	FormatJSON        = "json"
+	FormatSSHConfig   = "ssh_config"
+	FormatCSV         = "csv"
+	FormatAnsibleINI  = "ansible_ini"
+	FormatAnsibleYAML = "ansible_yaml"
+	FormatPuTTY       = "putty"
+	FormatMobaXterm   = "mobaxterm"
+	FormatXshell      = "xshell"
+	FormatTermius     = "termius"
+	FormatBundle      = "bundle"
+)
+
+// ImportReq 导入请求：servers 为要导入的列表，replace 为 true 时替换全部，false 时与当前合并。
+// format 为 ssh_config 时改为解析 content（上传的文件内容）或 path（本机路径，默认 ~/.ssh/config；path 仅限命令行导入），
+// 为 csv 时解析 content（带表头，逐行校验，错误行记入 report.errors），为 ansible_ini / ansible_yaml 时解析 content 中的 inventory；
+// 为 putty（.reg）、mobaxterm（.mxtsessions）、xshell（.xsh，path 可为会话目录）、termius（JSON）时解析 content 或 path；
+// 为 bundle 时用 passphrase 解密 content 中的加密包（format 为空时也会自动识别），可选恢复其中的私钥与 known_hosts；
+// dry_run 为 true 时只返回变更预览，不写入配置
 type ImportReq struct {
-	Servers []models.Server `json:"servers"`
-	Replace bool            `json:"replace"`
+	Servers   []models.Server   `json:"servers"`
+	Templates []models.Template `json:"templates,omitempty"` // JSON 导出中的模板，按 ID 或名称合并
+	Replace   bool              `json:"replace"`
+	Format    string            `json:"format,omitempty"`
+	Content   string            `json:"content,omitempty"`
+	Name      string            `json:"name,omitempty"` // 上传的文件名（xshell 以文件名作为会话名）
+	Path      string            `json:"path,omitempty"`
+	DryRun    bool              `json:"dry_run,omitempty"`
+
+	Passphrase        string `json:"passphrase,omitempty"`
+	RestoreKeys       bool   `json:"restore_keys,omitempty"`        // 将包内私钥写入配置目录 keys/，并改写服务器的私钥路径
+	RestoreKnownHosts bool   `json:"restore_known_hosts,omitempty"` // 将包内 known_hosts 中缺少的行追加到 ~/.ssh/known_hosts
 }
 
-// Import 导入 JSON 配置：replace 时替换全部，否则按 id 合并（存在则更新，不存在则追加）
+// ImportChange 导入预览中的一条变更
+type ImportChange struct {
+	Action string   `json:"action"` // create / update / unchanged / delete
+	ID     string   `json:"id,omitempty"`
+	Name   string   `json:"name"`
+	Host   string   `json:"host"`
+	Fields []string `json:"fields,omitempty"` // update 时发生变化的字段
+}
+
+// ImportResult 导入结果（dry_run 时为预览）
+type ImportResult struct {
+	Changes         []ImportChange  `json:"changes"`
+	Report          *convert.Report `json:"report,omitempty"`
+	Count           int             `json:"count"`                       // 导入后的服务器总数
+	KeysRestored    int             `json:"keys_restored,omitempty"`     // 写入的私钥文件数
+	KnownHostsAdded int             `json:"known_hosts_added,omitempty"` // 追加到 known_hosts 的行数
+}
+
+// ImportSource 解析后的待导入内容
+type ImportSource struct {
+	Servers   []models.Server
+	Templates []models.Template
+	Report    *convert.Report
+
+	bundle            *bundle.Bundle // 加密包：写入配置后按需恢复私钥与 known_hosts
+	restoreKeys       bool
+	restoreKnownHosts bool
+}
+
+// Import 导入配置：replace 时替换全部，否则按 id 合并（存在则更新，不存在则追加）
 func Import(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -48,57 +244,395 @@ func Import(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	if req.Servers == nil {
-		req.Servers = []models.Server{}
+	// 本机路径只供命令行导入使用，Web 接口不读取服务器上的任意文件（ssh_config 不带内容时仍读取默认的 ~/.ssh/config）
+	if req.Path != "" {
+		http.Error(w, "不支持通过 Web 读取本机路径，请上传文件内容", http.StatusBadRequest)
+		return
 	}
-	cfg, err := config.Load()
+	src, err := ParseImport(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := ImportServers(src, req.Replace, req.DryRun)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if req.Replace {
-		cfg.Servers = req.Servers
+	status := "ok"
+	if req.DryRun {
+		status = "preview"
 	} else {
-		existing := make(map[string]int)
-		for i, s := range cfg.Servers {
-			if s.ID != "" {
-				existing[s.ID] = i
+		audit.LogChange("import", auth.Actor(r), "", "format", req.Format, "replace", strconv.FormatBool(req.Replace),
+			"changes", strconv.Itoa(len(res.Changes)), "keys_restored", strconv.Itoa(res.KeysRestored))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":            status,
+		"count":             res.Count,
+		"changes":           res.Changes,
+		"report":            res.Report,
+		"keys_restored":     res.KeysRestored,
+		"known_hosts_added": res.KnownHostsAdded,
+	})
+}
+
+// ParseImport 按 format 解析导入请求；加密包缺少口令时返回 bundle.ErrPassphraseRequired
+func ParseImport(req *ImportReq) (*ImportSource, error) {
+	if req.Format == FormatBundle || (req.Format == "" && bundle.IsBundle([]byte(req.Content))) {
+		return parseBundle(req)
+	}
+	servers, report, err := parseFormat(req)
+	if err != nil {
+		return nil, err
+	}
+	src := &ImportSource{Servers: servers, Report: report}
+	if req.Format == "" || req.Format == FormatJSON {
+		src.Templates = req.Templates
+	}
+	return src, nil
+}
+
+// parseBundle 解密加密包；恢复私钥时将服务器的私钥路径改写为本机保存位置
+func parseBundle(req *ImportReq) (*ImportSource, error) {
+	text, err := importText(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := bundle.Open([]byte(text), req.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	src := &ImportSource{
+		Servers:           b.Config.Servers,
+		Templates:         b.Config.Templates,
+		Report:            &convert.Report{},
+		bundle:            b,
+		restoreKeys:       req.RestoreKeys && len(b.Keys) > 0,
+		restoreKnownHosts: req.RestoreKnownHosts && b.KnownHosts != "",
+	}
+	if src.restoreKeys {
+		dest, err := b.KeyDestinations()
+		if err != nil {
+			return nil, err
+		}
+		for i := range src.Servers {
+			if p, ok := dest[src.Servers[i].KeyPath]; ok {
+				src.Servers[i].KeyPath = p
 			}
 		}
-		maxID := 0
+		for i := range src.Templates {
+			if p, ok := dest[src.Templates[i].KeyPath]; ok {
+				src.Templates[i].KeyPath = p
+			}
+		}
+	} else if len(b.Keys) > 0 {
+		src.Report.Skipped = append(src.Report.Skipped, fmt.Sprintf("包内含 %d 个私钥文件，未选择恢复", len(b.Keys)))
+	}
+	return src, nil
+}
+
+// parseFormat 解析非加密格式
+func parseFormat(req *ImportReq) ([]models.Server, *convert.Report, error) {
+	switch req.Format {
+	case "", FormatJSON:
+		if req.Servers == nil {
+			return []models.Server{}, nil, nil
+		}
+		return req.Servers, nil, nil
+	case FormatSSHConfig:
+		if req.Content != "" {
+			return convert.ParseSSHConfigContent(req.Content)
+		}
+		return convert.ParseSSHConfig(req.Path)
+	case FormatCSV:
+		return convert.ParseCSV(strings.NewReader(req.Content))
+	case FormatAnsibleINI:
+		return convert.ParseAnsibleINI(strings.NewReader(req.Content))
+	case FormatAnsibleYAML:
+		return convert.ParseAnsibleYAML(strings.NewReader(req.Content))
+	case FormatXshell:
+		if req.Content == "" && req.Path != "" {
+			return convert.ParseXshellDir(req.Path)
+		}
+		return convert.ParseXshell(req.Name, "", req.Content)
+	case FormatPuTTY, FormatMobaXterm, FormatTermius:
+		text, err := importText(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch req.Format {
+		case FormatPuTTY:
+			return convert.ParsePuTTYReg(text)
+		case FormatMobaXterm:
+			return convert.ParseMobaXterm(text)
+		}
+		return convert.ParseTermius(text)
+	}
+	return nil, nil, fmt.Errorf("unsupported format: %s", req.Format)
+}
+
+// importText 取导入内容：优先使用上传的 content，否则读取本机 path（自动识别 UTF-16 编码）
+func importText(req *ImportReq) (string, error) {
+	if req.Content != "" {
+		return req.Content, nil
+	}
+	if req.Path == "" {
+		return "", fmt.Errorf("content or path required")
+	}
+	data, err := os.ReadFile(req.Path)
+	if err != nil {
+		return "", err
+	}
+	return convert.DecodeText(data), nil
+}
+
+// ImportServers 将 src 合并（或替换）进当前配置；dryRun 时只计算变更不保存。Web 导入与命令行导入共用
+func ImportServers(src *ImportSource, replace, dryRun bool) (*ImportResult, error) {
+	res := &ImportResult{Report: src.Report}
+	merge := func(cfg *models.Config) error {
+		// 先合并模板：导入的服务器引用的模板 ID 可能需要改写为本机已有的同名模板
+		remap := mergeTemplates(cfg, src.Templates, replace)
+		for i := range src.Servers {
+			if id, ok := remap[src.Servers[i].Template]; ok {
+				src.Servers[i].Template = id
+			}
+		}
+		res.Changes = mergeServers(cfg, src.Servers, replace)
+		res.Count = len(cfg.Servers)
+		return nil
+	}
+	if dryRun {
+		cfg, err := config.Load()
+		if err != nil {
+			return nil, err
+		}
+		_ = merge(cfg)
+		return res, nil
+	}
+	if err := config.Update(merge); err != nil {
+		return nil, err
+	}
+	if src.restoreKeys {
+		if err := src.bundle.RestoreKeys(); err != nil {
+			return nil, fmt.Errorf("恢复私钥失败: %w", err)
+		}
+		res.KeysRestored = len(src.bundle.Keys)
+	}
+	if src.restoreKnownHosts {
+		n, err := src.bundle.RestoreKnownHosts()
+		if err != nil {
+			return nil, fmt.Errorf("恢复 known_hosts 失败: %w", err)
+		}
+		res.KnownHostsAdded = n
+	}
+	return res, nil
+}
+
+// mergeServers 就地修改 cfg：replace 时替换全部；否则先按 UUID（含曾用 ID）匹配，再按 host+port+user 匹配，
+// 均未匹配则新增（导入条目带有未占用的 UUID 时沿用，便于多台机器之间合并，否则生成新的 UUID）。
+// 匹配到已有服务器而导入条目未带密码时（ssh_config、CSV 等格式不含密码）保留原密码
+func mergeServers(cfg *models.Config, incoming []models.Server, replace bool) []ImportChange {
+	changes := []ImportChange{}
+	for i := range incoming {
+		normalizeImported(&incoming[i])
+	}
+	if replace {
 		for _, s := range cfg.Servers {
-			if s.ID != "" {
-				n, _ := strconv.Atoi(s.ID)
-				if n > maxID {
-					maxID = n
+			changes = append(changes, ImportChange{Action: "delete", ID: s.ID, Name: s.Name, Host: s.Host})
+		}
+		dedupeIDs(incoming)
+		for _, s := range incoming {
+			changes = append(changes, ImportChange{Action: "create", ID: s.ID, Name: s.Name, Host: s.Host})
+		}
+		cfg.Servers = incoming
+		return changes
+	}
+	byAddr := make(map[string]int)
+	// 按生效配置比较登录目标，继承模板的服务器与导出为 CSV 等格式后的条目才能对应上
+	for i, s := range cfg.Servers {
+		key := addrKey(cfg.Resolve(s))
+		if _, ok := byAddr[key]; !ok {
+			byAddr[key] = i
+		}
+	}
+	for _, s := range incoming {
+		idx := -1
+		// 旧版数字 ID 在不同机器上会重复，只有 UUID 才按 ID 匹配
+		if config.IsUUID(s.ID) {
+			for i := range cfg.Servers {
+				if cfg.Servers[i].HasID(s.ID) {
+					idx = i
+					break
 				}
 			}
 		}
-		for _, s := range req.Servers {
-			s.Name = strings.TrimSpace(s.Name)
-			s.Host = strings.TrimSpace(s.Host)
-			s.User = strings.TrimSpace(s.User)
-			s.KeyPath = strings.TrimSpace(s.KeyPath)
-			s.Group = strings.TrimSpace(s.Group)
-			if s.Port <= 0 {
-				s.Port = 22
+		if idx < 0 {
+			if i, ok := byAddr[addrKey(cfg.Resolve(s))]; ok {
+				idx = i
+			}
+		}
+		if idx >= 0 {
+			cur := cfg.Servers[idx]
+			s.ID = cur.ID
+			s.Aliases = cur.Aliases
+			// 导入条目不含模板（CSV 等格式导出的是生效配置）时继续继承原模板，与模板相同的值不写成覆盖
+			if s.Template == "" && cur.Template != "" {
+				s.Template = cur.Template
+				stripInherited(cfg, &s)
+			}
+			if s.Password == "" {
+				s.Password = cur.Password
+			}
+			// 不含备注等信息的格式（CSV、inventory、其他客户端）导入时保留原有内容
+			if s.Notes == "" {
+				s.Notes = cur.Notes
+			}
+			if s.Fields == nil {
+				s.Fields = cur.Fields
 			}
-			if idx, ok := existing[s.ID]; ok && s.ID != "" {
-				cfg.Servers[idx] = s
-			} else {
-				maxID++
-				s.ID = strconv.Itoa(maxID)
-				cfg.Servers = append(cfg.Servers, s)
+			s.Favorite = s.Favorite || cur.Favorite
+			if s.LastConnected == nil || (cur.LastConnected != nil && cur.LastConnected.After(*s.LastConnected)) {
+				s.LastConnected = cur.LastConnected
 			}
+			fields := diffFields(cur, s)
+			action := "update"
+			if len(fields) == 0 {
+				action = "unchanged"
+			}
+			changes = append(changes, ImportChange{Action: action, ID: s.ID, Name: s.Name, Host: s.Host, Fields: fields})
+			cfg.Servers[idx] = s
+			continue
+		}
+		if !config.IsUUID(s.ID) || cfg.Find(s.ID) != nil {
+			s.ID = config.NewID()
 		}
+		s.Aliases = nil
+		cfg.Servers = append(cfg.Servers, s)
+		byAddr[addrKey(cfg.Resolve(s))] = len(cfg.Servers) - 1
+		changes = append(changes, ImportChange{Action: "create", ID: s.ID, Name: s.Name, Host: s.Host})
 	}
-	if err := config.Save(cfg); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	return changes
+}
+
+// mergeTemplates 合并导入的模板：按 ID、再按名称匹配已有模板并覆盖其内容（未带密码时保留原密码），否则新增；
+// replace 且导入内容带有模板时替换全部模板。返回导入模板 ID 到本机模板 ID 的映射
+func mergeTemplates(cfg *models.Config, incoming []models.Template, replace bool) map[string]string {
+	remap := make(map[string]string)
+	if len(incoming) == 0 {
+		return remap
+	}
+	if replace {
+		cfg.Templates = nil
+	}
+	for _, t := range incoming {
+		t.Name = strings.TrimSpace(t.Name)
+		cur := cfg.FindTemplate(t.ID)
+		if cur == nil || t.ID == "" {
+			cur = cfg.FindTemplate(t.Name)
+		}
+		if cur != nil {
+			if t.Password == "" {
+				t.Password = cur.Password
+			}
+			remap[t.ID] = cur.ID
+			t.ID = cur.ID
+			*cur = t
+			continue
+		}
+		if !config.IsUUID(t.ID) {
+			old := t.ID
+			t.ID = config.NewID()
+			if old != "" {
+				remap[old] = t.ID
+			}
+		}
+		cfg.Templates = append(cfg.Templates, t)
+	}
+	return remap
+}
+
+// stripInherited 清空与所继承模板相同的字段，使其继续随模板变化
+func stripInherited(cfg *models.Config, s *models.Server) {
+	t := cfg.FindTemplate(s.Template)
+	if t == nil {
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "ok",
-		"count":  len(cfg.Servers),
-	})
+	if s.Port == t.Port || (t.Port <= 0 && s.Port == 22) {
+		s.Port = 0
+	}
+	if s.User == t.User {
+		s.User = ""
+	}
+	if s.Password == t.Password {
+		s.Password = ""
+	}
+	if s.KeyPath == t.KeyPath {
+		s.KeyPath = ""
+	}
+	if s.ProxyJump == t.ProxyJump {
+		s.ProxyJump = ""
+	}
+}
+
+// addrKey 登录目标：主机（不区分大小写）+ 端口 + 用户
+func addrKey(s models.Server) string {
+	port := s.Port
+	if port <= 0 {
+		port = 22
+	}
+	return fmt.Sprintf("%s:%d:%s", strings.ToLower(s.Host), port, s.User)
+}
+
+func normalizeImported(s *models.Server) {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Host = strings.TrimSpace(s.Host)
+	s.User = strings.TrimSpace(s.User)
+	s.KeyPath = strings.TrimSpace(s.KeyPath)
+	s.Group = normalizeGroup(s.Group)
+	s.ProxyJump = strings.TrimSpace(s.ProxyJump)
+	s.Tags = normalizeTags(s.Tags)
+	s.Fields = normalizeFields(s.Fields)
+	s.Notes = strings.TrimSpace(s.Notes)
+	if s.Port <= 0 && s.Template == "" {
+		s.Port = 22
+	}
+}
+
+// diffFields 返回两台服务器之间取值不同的字段（以 json 字段名表示）
+func diffFields(a, b models.Server) []string {
+	var out []string
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "id" || name == "aliases" || name == "last_connected" {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// dedupeIDs 替换导入时为重复（或为空）的 ID 重新分配 UUID，并去掉与已用 ID 冲突的曾用 ID；
+// 否则导入包中重复的 UUID 会留下两台 Find 无法区分的服务器
+func dedupeIDs(servers []models.Server) {
+	used := make(map[string]bool, len(servers))
+	for i := range servers {
+		s := &servers[i]
+		if s.ID == "" || used[s.ID] {
+			s.ID = config.NewID()
+		}
+		used[s.ID] = true
+		var aliases []string
+		for _, a := range s.Aliases {
+			if !used[a] {
+				used[a] = true
+				aliases = append(aliases, a)
+			}
+		}
+		s.Aliases = aliases
+	}
 }
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+
+	"lwshell/internal/models"
+)
+
+func TestReplaceImportReassignsDuplicateIDs(t *testing.T) {
+	const id = "0b6f3a52-4c1e-4b6a-9f1d-2d6c8e9a7b31"
+	cfg := &models.Config{Servers: []models.Server{{ID: "old", Name: "old", Host: "h0", User: "u"}}}
+	incoming := []models.Server{
+		{ID: id, Name: "a", Host: "h1", User: "u"},
+		{ID: id, Name: "b", Host: "h2", User: "u", Aliases: []string{"1"}},
+		{ID: "c", Name: "c", Host: "h3", User: "u", Aliases: []string{"1"}},
+	}
+	mergeServers(cfg, incoming, true)
+	if len(cfg.Servers) != 3 {
+		t.Fatalf("got %d servers, want 3", len(cfg.Servers))
+	}
+	if cfg.Servers[0].ID != id || cfg.Servers[1].ID == id {
+		t.Fatalf("got IDs %q %q, want the first to keep %q", cfg.Servers[0].ID, cfg.Servers[1].ID, id)
+	}
+	if s := cfg.Find(cfg.Servers[1].ID); s == nil || s.Name != "b" {
+		t.Fatalf("reassigned ID does not find b: %+v", s)
+	}
+	if len(cfg.Servers[2].Aliases) != 0 {
+		t.Fatalf("duplicate alias kept: %v", cfg.Servers[2].Aliases)
+	}
+}
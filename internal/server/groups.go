@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/audit"
+	"lwshell/internal/auth"
+	"lwshell/internal/config"
+	"lwshell/internal/models"
+)
+
+// 分组支持路径形式（如 region/env/service），按 / 拆分为多级目录；目录只由其中的服务器决定，不单独存储
+
+// FolderResp 目录树节点：Path 为完整路径（根为空），Count 为含子目录在内的服务器数量
+type FolderResp struct {
+	Name    string        `json:"name"`
+	Path    string        `json:"path"`
+	Count   int           `json:"count"`
+	Folders []*FolderResp `json:"folders"`
+	Servers []ServerResp  `json:"servers"`
+}
+
+// normalizeGroup 规范化分组路径：去掉每级首尾空白与空的层级，如 " a / /b/ " -> "a/b"
+func normalizeGroup(g string) string {
+	var parts []string
+	for _, p := range strings.Split(g, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// treeFromConfig 将服务器按分组路径组织为目录树；未分组的服务器直接挂在根节点下
+func treeFromConfig(cfg *models.Config, f ServerFilter) *FolderResp {
+	root := &FolderResp{Folders: []*FolderResp{}, Servers: []ServerResp{}}
+	nodes := map[string]*FolderResp{"": root}
+	var folder func(path string) *FolderResp
+	folder = func(path string) *FolderResp {
+		if n, ok := nodes[path]; ok {
+			return n
+		}
+		parent, name := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent, name = path[:i], path[i+1:]
+		}
+		n := &FolderResp{Name: name, Path: path, Folders: []*FolderResp{}, Servers: []ServerResp{}}
+		p := folder(parent)
+		p.Folders = append(p.Folders, n)
+		nodes[path] = n
+		return n
+	}
+	for _, s := range cfg.Servers {
+		if !f.match(s) {
+			continue
+		}
+		path := normalizeGroup(s.Group)
+		n := folder(path)
+		n.Servers = append(n.Servers, toServerResp(cfg, s))
+		for p := path; ; {
+			nodes[p].Count++
+			if p == "" {
+				break
+			}
+			if i := strings.LastIndex(p, "/"); i >= 0 {
+				p = p[:i]
+			} else {
+				p = ""
+			}
+		}
+	}
+	for _, n := range nodes {
+		sort.Slice(n.Folders, func(i, j int) bool { return n.Folders[i].Name < n.Folders[j].Name })
+	}
+	return root
+}
+
+// GroupRenameReq POST /api/groups/rename：将目录 from（含子目录）重命名或移动为 to，to 为空表示把其内容移到根目录
+type GroupRenameReq struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// GroupMoveReq POST /api/groups/move：将服务器移动到目录 to（为空表示未分组）
+type GroupMoveReq struct {
+	IDs []string `json:"ids"`
+	To  string   `json:"to"`
+}
+
+var errGroupNotFound = errors.New("group not found")
+
+// GroupsAPI 处理 /api/groups/rename 与 /api/groups/move（拖放移动服务器、移动或重命名整个目录）
+func GroupsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		changed int
+		err     error
+	)
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/api/groups/rename":
+		var req GroupRenameReq
+		if json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		from, to := normalizeGroup(req.From), normalizeGroup(req.To)
+		if from == "" {
+			http.Error(w, "from required", http.StatusBadRequest)
+			return
+		}
+		if to == from || strings.HasPrefix(to, from+"/") {
+			http.Error(w, "不能移动到自身或其子目录", http.StatusBadRequest)
+			return
+		}
+		if !auth.Can(r, auth.PermEdit, from) || !auth.Can(r, auth.PermEdit, to) {
+			auth.Forbidden(w)
+			return
+		}
+		if changed, err = renameGroup(from, to); err == nil {
+			audit.LogChange("group_rename", auth.Actor(r), "", "from", from, "to", to, "servers", strconv.Itoa(changed))
+		}
+	case "/api/groups/move":
+		var req GroupMoveReq
+		if json.NewDecoder(r.Body).Decode(&req) != nil || len(req.IDs) == 0 {
+			http.Error(w, "invalid json, need {\"ids\":[...],\"to\":\"...\"}", http.StatusBadRequest)
+			return
+		}
+		to := normalizeGroup(req.To)
+		if changed, err = moveServers(r, req.IDs, to); err == nil {
+			audit.LogChange("server_move", auth.Actor(r), "", "ids", strings.Join(req.IDs, ","), "to", to, "servers", strconv.Itoa(changed))
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, errGroupNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "changed": changed})
+}
+
+// renameGroup 将 from 及其子目录下的服务器改到 to 下，保持相对层级；用户对这些分组的授权一并改写
+func renameGroup(from, to string) (int, error) {
+	changed := 0
+	err := config.Update(func(cfg *models.Config) error {
+		for i := range cfg.Servers {
+			g := normalizeGroup(cfg.Servers[i].Group)
+			if g != from && !strings.HasPrefix(g, from+"/") {
+				continue
+			}
+			cfg.Servers[i].Group = normalizeGroup(to + "/" + strings.TrimPrefix(g, from))
+			changed++
+		}
+		if changed == 0 {
+			return errGroupNotFound
+		}
+		// 授权按分组路径记录，随分组一起改名；失败时不保存配置
+		_, err := auth.RenameGrants(from, to)
+		return err
+	})
+	return changed, err
+}
+
+// moveServers 移动服务器；当前用户须对原分组与目标分组都有编辑权限
+func moveServers(r *http.Request, ids []string, to string) (int, error) {
+	changed := 0
+	err := config.Update(func(cfg *models.Config) error {
+		for _, id := range ids {
+			s := cfg.Find(id)
+			if s == nil {
+				return errServerNotFound
+			}
+			if !auth.Can(r, auth.PermEdit, s.Group) || !auth.Can(r, auth.PermEdit, to) {
+				return errForbidden
+			}
+			if s.Group != to {
+				s.Group = to
+				changed++
+			}
+		}
+		return nil
+	})
+	return changed, err
+}
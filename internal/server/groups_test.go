@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+
+	"lwshell/internal/auth"
+	"lwshell/internal/config"
+	"lwshell/internal/models"
+)
+
+func TestRenameGroupRewritesGrants(t *testing.T) {
+	useTempConfig(t)
+	cfg := &models.Config{Servers: []models.Server{{ID: "s1", Name: "db", Host: "10.0.0.1", User: "root", Group: "prod/db"}}}
+	if err := config.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	grants := []auth.Grant{{Group: "prod/db", Perms: []auth.Perm{auth.PermConnect}}, {Group: "production", Perms: []auth.Perm{auth.PermConnect}}}
+	if err := auth.CreateUser("ops", "password123", auth.RoleOperator, grants); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renameGroup("prod", "live"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := auth.FindUser("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Grants[0].Group != "live/db" || u.Grants[1].Group != "production" {
+		t.Fatalf("got grants %+v, want live/db and production", u.Grants)
+	}
+	if !u.Can(auth.PermConnect, "live/db") || u.Can(auth.PermConnect, "prod/db") {
+		t.Fatal("grant did not follow the renamed group")
+	}
+}
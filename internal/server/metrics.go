@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"lwshell/internal/auth"
+	"lwshell/internal/config"
+	"lwshell/internal/metrics"
+)
+
+// Metrics 返回每台服务器最近的指标采样（按服务器 ID 分组，时间升序）；
+// 与导出相同按分组过滤，只包含当前用户在其分组中拥有连接、编辑或导出权限的服务器
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	all := metrics.All()
+	out := make(map[string][]metrics.Sample, len(all))
+	for _, s := range cfg.Servers {
+		list, ok := all[s.ID]
+		if !ok || !canSeeMetrics(r, s.Group) {
+			continue
+		}
+		out[s.ID] = list
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"servers": out})
+}
+
+func canSeeMetrics(r *http.Request, group string) bool {
+	return auth.Can(r, auth.PermConnect, group) || auth.Can(r, auth.PermEdit, group) || auth.Can(r, auth.PermExport, group)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"lwshell/internal/models"
+)
+
+// ServerFilter GET /api/servers 的筛选条件：
+// q 为空格分隔的关键词，每个关键词须出现在名称、主机、用户、分组、标签、备注或自定义字段（key=value）中（不区分大小写）；
+// tags 中的每个标签都须存在（精确匹配，以 : 结尾时按前缀匹配，如 env: 匹配 env:prod）；group 为分组路径（含子目录）
+type ServerFilter struct {
+	Q     string
+	Tags  []string
+	Group string
+}
+
+func (f ServerFilter) empty() bool {
+	return strings.TrimSpace(f.Q) == "" && len(f.Tags) == 0 && f.Group == ""
+}
+
+func (f ServerFilter) match(s models.Server) bool {
+	if f.Group != "" {
+		g := s.Group
+		if g == "" {
+			g = ungroupedName
+		}
+		// 与目录树一致，筛选某个分组时包含其子目录
+		if g != f.Group && !strings.HasPrefix(g, f.Group+"/") {
+			return false
+		}
+	}
+	for _, want := range f.Tags {
+		if !hasTag(s.Tags, want) {
+			return false
+		}
+	}
+	for _, word := range strings.Fields(strings.ToLower(f.Q)) {
+		if !containsWord(s, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsWord(s models.Server, word string) bool {
+	for _, v := range []string{s.Name, s.Host, s.User, s.Group} {
+		if strings.Contains(strings.ToLower(v), word) {
+			return true
+		}
+	}
+	for _, t := range s.Tags {
+		if strings.Contains(strings.ToLower(t), word) {
+			return true
+		}
+	}
+	if strings.Contains(strings.ToLower(s.Notes), word) {
+		return true
+	}
+	for k, v := range s.Fields {
+		if strings.Contains(strings.ToLower(k+"="+v), word) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(tags []string, want string) bool {
+	want = strings.ToLower(strings.TrimSpace(want))
+	for _, t := range tags {
+		t = strings.ToLower(t)
+		if t == want || (strings.HasSuffix(want, ":") && strings.HasPrefix(t, want)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTags 去掉空白与重复（不区分大小写，保留首次出现的写法）；没有标签时返回 nil
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		key := strings.ToLower(t)
+		if t == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// allTags 配置中出现过的全部标签（排序、去重），供前端展示可选标签
+func allTags(servers []models.Server) []string {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, s := range servers {
+		for _, t := range s.Tags {
+			if !seen[strings.ToLower(t)] {
+				seen[strings.ToLower(t)] = true
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lwshell/internal/audit"
+	"lwshell/internal/auth"
+	"lwshell/internal/config"
+	"lwshell/internal/models"
+)
+
+// TemplateResp 对外暴露的模板（不含密码）；Servers 为继承该模板的服务器数量
+type TemplateResp struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Port        int    `json:"port,omitempty"`
+	User        string `json:"user,omitempty"`
+	KeyPath     string `json:"key_path,omitempty"`
+	ProxyJump   string `json:"proxy_jump,omitempty"`
+	HasPassword bool   `json:"has_password"`
+	Servers     int    `json:"servers"`
+}
+
+// TemplateBody 创建 / 编辑模板的请求体；编辑时 Password 为 nil 表示不修改原密码
+type TemplateBody struct {
+	Name      string  `json:"name"`
+	Port      int     `json:"port"`
+	User      string  `json:"user"`
+	Password  *string `json:"password,omitempty"`
+	KeyPath   string  `json:"key_path"`
+	ProxyJump string  `json:"proxy_jump"`
+}
+
+var (
+	errTemplateInUse    = errors.New("template in use")
+	errTemplateNameUsed = errors.New("template name already exists")
+)
+
+// TemplatesAPI 服务器模板：
+// GET /api/templates 列出模板；POST /api/templates 创建；PUT /api/templates/:id 修改（继承的服务器随之生效）；
+// DELETE /api/templates/:id 删除，仍有服务器继承时返回 409，?detach=1 时先将模板的值写入这些服务器再删除。
+// 模板影响多个分组，修改仅限管理员
+func TemplatesAPI(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/templates"), "/")
+	if r.Method != http.MethodGet && !auth.Can(r, auth.PermAdmin, "") {
+		auth.Forbidden(w)
+		return
+	}
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		listTemplates(w)
+	case id == "" && r.Method == http.MethodPost:
+		saveTemplate(w, r, "")
+	case id != "" && r.Method == http.MethodPut:
+		saveTemplate(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		deleteTemplate(w, r, id, r.URL.Query().Get("detach") == "1")
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listTemplates(w http.ResponseWriter) {
+	cfg, err := config.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	uses := make(map[string]int)
+	for _, s := range cfg.Servers {
+		if t := cfg.FindTemplate(s.Template); t != nil {
+			uses[t.ID]++
+		}
+	}
+	out := make([]TemplateResp, 0, len(cfg.Templates))
+	for _, t := range cfg.Templates {
+		out = append(out, TemplateResp{
+			ID:          t.ID,
+			Name:        t.Name,
+			Port:        t.Port,
+			User:        t.User,
+			KeyPath:     t.KeyPath,
+			ProxyJump:   t.ProxyJump,
+			HasPassword: t.Password != "",
+			Servers:     uses[t.ID],
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"templates": out})
+}
+
+// saveTemplate 创建（id 为空）或修改模板
+func saveTemplate(w http.ResponseWriter, r *http.Request, id string) {
+	var body TemplateBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	if body.Port < 0 || body.Port > 65535 {
+		http.Error(w, "invalid port", http.StatusBadRequest)
+		return
+	}
+	action := "template_update"
+	if id == "" {
+		action = "template_create"
+	}
+	err := config.Update(func(cfg *models.Config) error {
+		if other := cfg.FindTemplate(body.Name); other != nil && other.ID != id {
+			return errTemplateNameUsed
+		}
+		var t *models.Template
+		if id == "" {
+			cfg.Templates = append(cfg.Templates, models.Template{ID: config.NewID()})
+			t = &cfg.Templates[len(cfg.Templates)-1]
+		} else if t = cfg.FindTemplate(id); t == nil {
+			return errTemplateNotFound
+		}
+		id = t.ID
+		t.Name = body.Name
+		t.Port = body.Port
+		t.User = strings.TrimSpace(body.User)
+		t.KeyPath = strings.TrimSpace(body.KeyPath)
+		t.ProxyJump = strings.TrimSpace(body.ProxyJump)
+		if body.Password != nil {
+			t.Password = strings.TrimSpace(*body.Password)
+		}
+		return nil
+	})
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	audit.LogChange(action, auth.Actor(r), id, "name", body.Name)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "id": id})
+}
+
+func deleteTemplate(w http.ResponseWriter, r *http.Request, id string, detach bool) {
+	var name string
+	users := 0
+	err := config.Update(func(cfg *models.Config) error {
+		t := cfg.FindTemplate(id)
+		if t == nil {
+			return errTemplateNotFound
+		}
+		id, name = t.ID, t.Name
+		users = 0
+		for i := range cfg.Servers {
+			if cfg.FindTemplate(cfg.Servers[i].Template) != t {
+				continue
+			}
+			users++
+			if detach {
+				cfg.Servers[i] = cfg.Resolve(cfg.Servers[i])
+				cfg.Servers[i].Template = ""
+			}
+		}
+		if users > 0 && !detach {
+			return fmt.Errorf("%w: %d 台服务器继承该模板", errTemplateInUse, users)
+		}
+		for i := range cfg.Templates {
+			if &cfg.Templates[i] == t {
+				cfg.Templates = append(cfg.Templates[:i], cfg.Templates[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	audit.LogChange("template_delete", auth.Actor(r), id, "name", name, "detached", strconv.Itoa(users))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// writeTemplateError 模板不存在 404，名称重复或仍被使用 409
+func writeTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTemplateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errTemplateInUse), errors.Is(err, errTemplateNameUsed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
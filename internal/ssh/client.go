@@ -15,8 +15,9 @@ import (
 
 // ConnectOptions 连接时可覆盖的选项（如临时指定证书路径）
 type ConnectOptions struct {
-	KeyPathOverride string // 若不为空，则用此路径的私钥，忽略 Server.KeyPath
-	WindowTitle     string // 若不为空，连接期间定期写入 /dev/tty 以固定窗口标题（防止远程覆盖）
+	KeyPathOverride string          // 若不为空，则用此路径的私钥，忽略 Server.KeyPath
+	WindowTitle     string          // 若不为空，连接期间定期写入 /dev/tty 以固定窗口标题（防止远程覆盖）
+	Jumps           []models.Server // 依次经过的跳板机（由 JumpChain 解析 ProxyJump 得到）
 }
 
 // Connect 建立 SSH 连接并进入交互式终端；auth 优先使用证书（KeyPath），其次密码
@@ -26,17 +27,11 @@ func Connect(s models.Server, opts ConnectOptions) error {
 		keyPath = opts.KeyPathOverride
 	}
 
-	config, err := buildClientConfig(s.User, s.Password, keyPath)
+	client, closeAll, err := dial(s, keyPath, opts.Jumps, 0, nil)
 	if err != nil {
 		return err
 	}
-
-	addr := fmt.Sprintf("%s:%d", s.Host, port(s))
-	client, err := ssh.Dial("tcp", addr, config)
-	if err != nil {
-		return fmt.Errorf("连接失败: %w", err)
-	}
-	defer client.Close()
+	defer closeAll()
 
 	session, err := client.NewSession()
 	if err != nil {
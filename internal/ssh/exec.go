@@ -0,0 +1,63 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"lwshell/internal/models"
+)
+
+// Run 以非交互方式在远程执行一条命令并返回标准输出（用于采集指标等后台任务），jumps 为跳板机链。
+// 后台任务没有人核对主机密钥，只连接 ~/.ssh/known_hosts 中已记录且密钥一致的主机，避免把密码发给冒充的主机
+func Run(s models.Server, jumps []models.Server, cmd string, timeout time.Duration) (string, error) {
+	hostKeys, err := knownHostsCallback()
+	if err != nil {
+		return "", err
+	}
+	client, closeAll, err := dial(s, s.KeyPath, jumps, timeout, hostKeys)
+	if err != nil {
+		return "", err
+	}
+	defer closeAll()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("创建会话失败: %w", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	// 命令执行超时：关闭连接使 Run 返回，避免远程命令卡住采集
+	timer := time.AfterFunc(timeout, closeAll)
+	defer timer.Stop()
+
+	if err := session.Run(cmd); err != nil {
+		if stderr.Len() > 0 {
+			return stdout.String(), fmt.Errorf("执行失败: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return stdout.String(), fmt.Errorf("执行失败: %w", err)
+	}
+	return stdout.String(), nil
+}
+
+// knownHostsCallback 按 ~/.ssh/known_hosts 校验主机密钥
+func knownHostsCallback() (ssh.HostKeyCallback, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	cb, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("读取 known_hosts 失败，后台任务只连接已知主机: %w", err)
+	}
+	return cb, nil
+}
@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"lwshell/internal/models"
+)
+
+// maxJumpDepth 跳板机链最大长度，防止 ProxyJump 互相引用导致死循环
+const maxJumpDepth = 8
+
+// JumpChain 将 s.ProxyJump 解析为按连接顺序排列的跳板机列表。
+// 每一跳优先匹配已配置服务器的名称（其自身的 ProxyJump 会递归展开），
+// 否则按 [user@]host[:port] 解析，并沿用目标服务器的私钥（不沿用密码）。
+func JumpChain(s models.Server, servers []models.Server) ([]models.Server, error) {
+	return jumpChain(s, servers, 0)
+}
+
+func jumpChain(s models.Server, servers []models.Server, depth int) ([]models.Server, error) {
+	if strings.TrimSpace(s.ProxyJump) == "" {
+		return nil, nil
+	}
+	if depth >= maxJumpDepth {
+		return nil, fmt.Errorf("跳板机链过长或存在循环引用: %s", s.ProxyJump)
+	}
+	var chain []models.Server
+	for _, hop := range strings.Split(s.ProxyJump, ",") {
+		hop = strings.TrimSpace(hop)
+		if hop == "" {
+			continue
+		}
+		if js, ok := findByName(servers, hop); ok {
+			sub, err := jumpChain(js, servers, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, sub...)
+			js.ProxyJump = ""
+			chain = append(chain, js)
+			continue
+		}
+		js, err := parseHop(hop, s)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, js)
+	}
+	return chain, nil
+}
+
+func findByName(servers []models.Server, name string) (models.Server, bool) {
+	for _, s := range servers {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return models.Server{}, false
+}
+
+// parseHop 解析 [user@]host[:port]。未配置为服务器的跳板机只沿用目标的私钥，不会把目标的密码发给它
+func parseHop(hop string, target models.Server) (models.Server, error) {
+	if target.KeyPath == "" {
+		return models.Server{}, fmt.Errorf("跳板机 %s 不是已配置的服务器，且目标未配置私钥：请先将跳板机添加为服务器并配置认证", hop)
+	}
+	js := models.Server{
+		Name:    hop,
+		User:    target.User,
+		KeyPath: target.KeyPath,
+		Port:    22,
+	}
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		js.User = hop[:i]
+		hop = hop[i+1:]
+	}
+	js.Host = hop
+	if h, p, err := net.SplitHostPort(hop); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return js, fmt.Errorf("跳板机端口无效: %s", hop)
+		}
+		js.Host, js.Port = h, n
+	}
+	return js, nil
+}
+
+// dial 依次经过跳板机建立到 s 的 SSH 连接；返回的 closer 会关闭整条链路。
+// hostKeys 为空时不校验主机密钥（交互连接的原有行为）
+func dial(s models.Server, keyPath string, jumps []models.Server, timeout time.Duration, hostKeys ssh.HostKeyCallback) (*ssh.Client, func(), error) {
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			_ = clients[i].Close()
+		}
+	}
+	hops := append(append([]models.Server(nil), jumps...), s)
+	for i, h := range hops {
+		kp := h.KeyPath
+		if i == len(hops)-1 {
+			kp = keyPath
+		}
+		config, err := buildClientConfig(h.User, h.Password, kp)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		config.Timeout = timeout
+		if hostKeys != nil {
+			config.HostKeyCallback = hostKeys
+		}
+		addr := net.JoinHostPort(h.Host, strconv.Itoa(port(h)))
+		var client *ssh.Client
+		if len(clients) == 0 {
+			client, err = ssh.Dial("tcp", addr, config)
+		} else {
+			client, err = dialVia(clients[len(clients)-1], addr, config)
+		}
+		if err != nil {
+			closeAll()
+			if i < len(hops)-1 {
+				return nil, nil, fmt.Errorf("连接跳板机 %s 失败: %w", h.Name, err)
+			}
+			return nil, nil, fmt.Errorf("连接失败: %w", err)
+		}
+		clients = append(clients, client)
+	}
+	return clients[len(clients)-1], closeAll, nil
+}
+
+func dialVia(jump *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := jump.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
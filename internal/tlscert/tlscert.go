@@ -0,0 +1,244 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	validFor    = 2 * 365 * 24 * time.Hour
+	renewBefore = 30 * 24 * time.Hour // 剩余有效期不足时重新生成
+)
+
+// certDir 证书目录：os.UserConfigDir()/lwshell/tls
+func certDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lwshell", "tls"), nil
+}
+
+// LoadOrCreate 返回自签名证书与私钥文件的路径（cert.pem、key.pem）。证书必须包含 localhost、回环地址、本机主机名与 hosts；
+// 文件不存在、即将过期或缺少其中的名称时重新签发，created 为 true。网卡地址只在签发时顺带写入，不作为必需项，
+// 避免 DHCP 等地址变化导致每次启动都换证书；重新签发时沿用已有的 key.pem，私钥保持不变
+func LoadOrCreate(hosts []string) (certFile, keyFile string, created bool, err error) {
+	dir, err := certDir()
+	if err != nil {
+		return "", "", false, err
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	names, ips := subjectNames(hosts)
+	old, err := readCert(certFile)
+	if err == nil && covers(old, names, ips) && time.Until(old.NotAfter) > renewBefore {
+		if _, err := os.Stat(keyFile); err == nil {
+			return certFile, keyFile, false, nil
+		}
+	}
+	for _, ip := range interfaceIPs() {
+		if !containsIP(ips, ip) {
+			ips = append(ips, ip)
+		}
+	}
+	if old != nil {
+		// 保留旧证书中的名称，补签新名称时不丢失原来可用的访问地址
+		for _, n := range old.DNSNames {
+			if !containsName(names, n) {
+				names = append(names, n)
+			}
+		}
+		for _, ip := range old.IPAddresses {
+			if !containsIP(ips, ip) {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if err := generate(certFile, keyFile, names, ips); err != nil {
+		return "", "", false, err
+	}
+	return certFile, keyFile, true, nil
+}
+
+// subjectNames 证书必须包含的主机名与 IP
+func subjectNames(hosts []string) ([]string, []net.IP) {
+	names := []string{"localhost"}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		hosts = append(hosts, h)
+	}
+	for _, h := range hosts {
+		h = strings.ToLower(strings.Trim(strings.TrimSpace(h), "[]"))
+		if h == "" {
+			continue
+		}
+		if ip := net.ParseIP(h); ip != nil {
+			if !ip.IsUnspecified() && !containsIP(ips, ip) {
+				ips = append(ips, ip)
+			}
+		} else if !containsName(names, h) {
+			names = append(names, h)
+		}
+	}
+	return names, ips
+}
+
+// interfaceIPs 本机各网卡当前的地址（不含回环与链路本地地址）
+func interfaceIPs() []net.IP {
+	var ips []net.IP
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && !n.IP.IsLinkLocalUnicast() {
+			ips = append(ips, n.IP)
+		}
+	}
+	return ips
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, v := range ips {
+		if v.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsName(names []string, name string) bool {
+	for _, v := range names {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers 判断证书是否已包含全部名称
+func covers(c *x509.Certificate, names []string, ips []net.IP) bool {
+	for _, n := range names {
+		if !containsName(c.DNSNames, n) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !containsIP(c.IPAddresses, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("invalid certificate PEM: " + path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// readKey 读取 key.pem 中的 ECDSA 私钥
+func readKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("invalid private key PEM: " + path)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("unsupported private key type: " + path)
+	}
+	return key, nil
+}
+
+// generate 签发 ECDSA P-256 自签名证书；已有可用的 key.pem 时沿用，否则生成新私钥（文件权限 0600）。
+// 文件均先写临时文件再重命名
+func generate(certFile, keyFile string, names []string, ips []net.IP) error {
+	key, err := readKey(keyFile)
+	newKey := err != nil
+	if newKey {
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return err
+		}
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "lwshell", Organization: []string{"lwshell self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              names,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return err
+	}
+	if newKey {
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+			return err
+		}
+	}
+	return writeFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Fingerprint 返回证书文件中第一张证书的 SHA-256 指纹（冒号分隔的大写十六进制），供用户在浏览器中核对
+func Fingerprint(certFile string) (string, error) {
+	c, err := readCert(certFile)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(c.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":"), nil
+}